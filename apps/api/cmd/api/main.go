@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/yourorg/nous/internal/api/handlers"
 	"github.com/yourorg/nous/internal/database"
@@ -55,7 +57,28 @@ func main() {
 	repo := repository.New(db)
 
 	// Initialize WebSocket hub
-	wsHub := ws.NewHub()
+	wsConfig := ws.DefaultConfig()
+	if origins := os.Getenv("WS_ALLOWED_ORIGINS"); origins != "" {
+		wsConfig.AllowedOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				wsConfig.AllowedOrigins = append(wsConfig.AllowedOrigins, origin)
+			}
+		}
+	}
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		redisOpts, err := redis.ParseURL(redisURL)
+		if err != nil {
+			log.Fatalf("Invalid REDIS_URL: %v", err)
+		}
+		redisClient := redis.NewClient(redisOpts)
+		defer redisClient.Close()
+		wsConfig.Backplane = ws.NewRedisBackplane(redisClient, os.Getenv("WS_REDIS_CHANNEL"))
+	}
+	wsHub, err := ws.NewHubWithConfig(wsConfig)
+	if err != nil {
+		log.Fatalf("Invalid WebSocket configuration: %v", err)
+	}
 	go wsHub.Run()
 
 	// Initialize handlers with WebSocket hub
@@ -87,6 +110,7 @@ func main() {
 
 	// WebSocket routes (more specific routes first)
 	r.Get("/ws/health", h.WebSocketHealthCheck) // WebSocket health check
+	r.Get("/ws/ready", wsHub.HealthHandler)     // WebSocket readiness: 503 when overloaded or draining
 	r.Get("/ws", wsHub.ServeWS)                 // WebSocket endpoint
 
 	// API routes
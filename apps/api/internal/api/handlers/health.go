@@ -79,13 +79,14 @@ func (h *Handlers) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 
 // WebSocketHealthCheck returns WebSocket hub status
 func (h *Handlers) WebSocketHealthCheck(w http.ResponseWriter, r *http.Request) {
-	clientCount := h.hub.GetClientCount()
+	stats := h.hub.Stats()
 
 	response := map[string]interface{}{
 		"status":      "active",
-		"connections": clientCount,
+		"connections": stats.ConnectedClients,
 		"endpoint":    "/ws",
 		"protocol":    "RFC 6455 (WebSocket)",
+		"stats":       stats,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ackMessageType is sent by a client to acknowledge a message by ID
+const ackMessageType = "ack"
+
+// ackData is the payload of an ack message
+type ackData struct {
+	ID string `json:"id"`
+}
+
+// AckHandler is called when a client acknowledges a message, or fails to
+// within Config.AckTimeout
+type AckHandler func(c *Client, messageID string)
+
+// OnAck registers the callback invoked when a client acknowledges a message
+// sent with BroadcastMessageWithAck. It runs on the client's dispatch goroutine
+// Must be called before the hub starts serving connections
+func (h *Hub) OnAck(fn AckHandler) {
+	h.onAck = fn
+}
+
+// OnAckTimeout registers the callback invoked when a client hasn't
+// acknowledged a message within Config.AckTimeout, or disconnected first
+// It runs on a timer goroutine, or on the goroutine that removed the client
+// Must be called before the hub starts serving connections
+func (h *Hub) OnAckTimeout(fn AckHandler) {
+	h.onAckTimeout = fn
+}
+
+// BroadcastMessageWithAck sends a message carrying a unique ID to all
+// connected clients and expects each to reply {"type":"ack","data":{"id":...}}
+// OnAck or OnAckTimeout fires per client. Returns the message ID, or an error
+// if the message couldn't be encoded or queued
+func (h *Hub) BroadcastMessageWithAck(eventType string, data interface{}) (string, error) {
+	message := Message{
+		ID:   uuid.NewString(),
+		Type: eventType,
+		Data: data,
+	}
+
+	if err := h.sendBroadcast(message, broadcastRequest{ackID: message.ID}); err != nil {
+		return "", err
+	}
+	return message.ID, nil
+}
+
+// expectAck starts waiting for the client to acknowledge messageID
+func (c *Client) expectAck(messageID string) {
+	timeout := c.hub.config.AckTimeout
+
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+
+	if c.pendingAcks == nil {
+		c.pendingAcks = make(map[string]*time.Timer)
+	}
+	c.pendingAcks[messageID] = time.AfterFunc(timeout, func() {
+		c.ackMu.Lock()
+		_, pending := c.pendingAcks[messageID]
+		delete(c.pendingAcks, messageID)
+		c.ackMu.Unlock()
+
+		if pending {
+			c.log.Warn("WebSocket client did not acknowledge message", "message_id", messageID, "timeout", timeout)
+			if fn := c.hub.onAckTimeout; fn != nil {
+				fn(c, messageID)
+			}
+		}
+	})
+}
+
+// requestAck clears the pending entry for an ack message from the client
+// Returns false if the message is not an ack
+func (c *Client) requestAck(msg Message) bool {
+	if msg.Type != ackMessageType {
+		return false
+	}
+
+	var data ackData
+	raw, _ := msg.Data.(json.RawMessage)
+	if err := json.Unmarshal(raw, &data); err != nil || data.ID == "" {
+		c.log.Warn("WebSocket client sent malformed ack", "error", err)
+		return true
+	}
+
+	c.ackMu.Lock()
+	timer, pending := c.pendingAcks[data.ID]
+	delete(c.pendingAcks, data.ID)
+	c.ackMu.Unlock()
+
+	if !pending {
+		return true
+	}
+	timer.Stop()
+	if fn := c.hub.onAck; fn != nil {
+		fn(c, data.ID)
+	}
+	return true
+}
+
+// cancelAcks stops waiting for acknowledgements from a disconnected client,
+// reporting each message it never acknowledged to OnAckTimeout
+func (c *Client) cancelAcks() {
+	c.ackMu.Lock()
+	lost := make([]string, 0, len(c.pendingAcks))
+	for id, timer := range c.pendingAcks {
+		timer.Stop()
+		delete(c.pendingAcks, id)
+		lost = append(lost, id)
+	}
+	c.ackMu.Unlock()
+
+	if fn := c.hub.onAckTimeout; fn != nil {
+		for _, id := range lost {
+			fn(c, id)
+		}
+	}
+}
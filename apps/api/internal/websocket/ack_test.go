@@ -0,0 +1,81 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+	"github.com/yourorg/nous/internal/websocket/wstest"
+)
+
+// ackHub runs a hub whose ack callbacks report message IDs on the returned channels
+func ackHub(t *testing.T) (hub *ws.Hub, srv *wstest.Server, acked, timedOut chan string) {
+	t.Helper()
+	hub, err := ws.NewHubWithConfig(ws.Config{AckTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	acked = make(chan string, 1)
+	timedOut = make(chan string, 1)
+	hub.OnAck(func(c *ws.Client, id string) { acked <- id })
+	hub.OnAckTimeout(func(c *ws.Client, id string) { timedOut <- id })
+	go hub.Run()
+	srv = wstest.NewServer(hub)
+	t.Cleanup(func() {
+		srv.Close()
+		hub.Shutdown()
+	})
+	return hub, srv, acked, timedOut
+}
+
+// receive returns the next ID sent on ch, failing the test after a second
+func receive(t *testing.T, ch chan string, what string) string {
+	t.Helper()
+	select {
+	case id := <-ch:
+		return id
+	case <-time.After(time.Second):
+		t.Fatalf("%s never fired", what)
+		return ""
+	}
+}
+
+func TestBroadcastMessageWithAckCallsOnAck(t *testing.T) {
+	hub, srv, acked, _ := ackHub(t)
+	client := dial(t, srv, "")
+
+	id, err := hub.BroadcastMessageWithAck("job", nil)
+	if err != nil {
+		t.Fatalf("BroadcastMessageWithAck: %v", err)
+	}
+	msg, err := client.Next(time.Second)
+	if err != nil || msg.ID != id {
+		t.Fatalf("Next = %+v, %v; want message %s", msg, err, id)
+	}
+	if err := client.Send("ack", map[string]string{"id": id}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := receive(t, acked, "OnAck"); got != id {
+		t.Fatalf("OnAck id = %s, want %s", got, id)
+	}
+}
+
+func TestBroadcastMessageWithAckReportsDisconnectedClients(t *testing.T) {
+	hub, srv, _, timedOut := ackHub(t)
+	client := dial(t, srv, "")
+
+	id, err := hub.BroadcastMessageWithAck("job", nil)
+	if err != nil {
+		t.Fatalf("BroadcastMessageWithAck: %v", err)
+	}
+	if _, err := client.Next(time.Second); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	client.Close()
+
+	// Well before AckTimeout, since the client can no longer acknowledge it
+	if got := receive(t, timedOut, "OnAckTimeout"); got != id {
+		t.Fatalf("OnAckTimeout id = %s, want %s", got, id)
+	}
+}
@@ -0,0 +1,27 @@
+package websocket
+
+// BroadcastAdmin sends a message straight to every connected client's
+// high-priority lane and reports how many it was queued to
+// It skips the broadcast channel, batching and compression, so it isn't held
+// up behind a backlog of other broadcasts. Delivery is still non-blocking per
+// client: clients with full buffers miss it as with any other broadcast
+// The message is local to this instance, isn't sequenced for replay and is
+// encoded and queued on the caller's goroutine, so this is meant for rare,
+// important messages such as maintenance notices or forced refreshes only
+func (h *Hub) BroadcastAdmin(eventType string, data interface{}) int {
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data})
+	if err != nil {
+		return 0
+	}
+	frame = BroadcastOptions{Priority: PriorityHigh, NoCompress: true}.apply(frame)
+
+	reached := 0
+	for _, client := range h.snapshot() {
+		if h.deliver(client, frame) {
+			reached++
+		}
+	}
+	h.counters.messagesBroadcast.Add(1)
+	h.countEventType(eventType, 1)
+	return reached
+}
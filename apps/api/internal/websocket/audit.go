@@ -0,0 +1,77 @@
+package websocket
+
+import "time"
+
+// Audit event names
+const (
+	AuditConnect     = "connect"
+	AuditDisconnect  = "disconnect"
+	AuditKick        = "kick"
+	AuditAuthFailure = "auth_failure"
+)
+
+// Number of audit events buffered for a slow AuditSink before they are dropped
+const auditBuffer = 1024
+
+// AuditEvent is a machine-readable record of a connection lifecycle event
+type AuditEvent struct {
+	Event      string    `json:"event"`
+	ClientID   string    `json:"client_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Timestamp  time.Time `json:"timestamp"`
+
+	// Reason is the close reason, kick reason or authentication error
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditSink receives connection lifecycle events, e.g. to write them to a
+// compliance log. Audit is called from a single goroutine in event order;
+// events that arrive while more than auditBuffer are waiting are dropped and
+// counted in Stats.AuditEventsDropped
+type AuditSink interface {
+	Audit(event AuditEvent)
+}
+
+// audit queues an event for the AuditSink without blocking
+func (h *Hub) audit(event AuditEvent) {
+	if h.auditQueue == nil {
+		return
+	}
+	event.Timestamp = time.Now()
+
+	select {
+	case h.auditQueue <- event:
+	default:
+		h.counters.auditDropped.Add(1)
+	}
+}
+
+// runAudit delivers queued audit events to the sink until the hub has shut
+// down and every client has disconnected
+func (h *Hub) runAudit() {
+	go func() {
+		for {
+			select {
+			case event := <-h.auditQueue:
+				h.config.AuditSink.Audit(event)
+			case <-h.auditStop:
+				for {
+					select {
+					case event := <-h.auditQueue:
+						h.config.AuditSink.Audit(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// stopAudit lets the audit goroutine exit once it has delivered what is queued
+func (h *Hub) stopAudit() {
+	if h.auditStop == nil {
+		return
+	}
+	h.auditOnce.Do(func() { close(h.auditStop) })
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Authenticator validates a WebSocket upgrade request before it is accepted
+// It returns the authenticated user's ID, or an error to reject the request
+type Authenticator func(r *http.Request) (userID string, err error)
+
+// BearerToken extracts a token from the "Authorization: Bearer" header,
+// falling back to the token query parameter (browsers can't set headers
+// on WebSocket requests). Returns "" if neither is present
+func BearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticate runs the configured authenticator, if any
+// On failure it writes a 401 response and returns false
+func (h *Hub) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.config.Authenticator == nil {
+		return "", true
+	}
+
+	userID, err := h.config.Authenticator(r)
+	if err != nil {
+		h.logger.Warn("WebSocket authentication failed", "error", err, "remote_addr", r.RemoteAddr)
+		h.audit(AuditEvent{Event: AuditAuthFailure, RemoteAddr: r.RemoteAddr, Reason: err.Error()})
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, true
+}
+
+// UserID returns the user ID established by the hub's Authenticator
+// It is empty when no authenticator is configured
+func (c *Client) UserID() string {
+	return c.userID
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// backplaneBuffer is the number of broadcasts queued for publishing
+	backplaneBuffer = 256
+
+	// backplaneRetryDelay is how long to wait before resubscribing after an error
+	backplaneRetryDelay = 2 * time.Second
+
+	// backplanePublishTimeout bounds a single publish to the backplane
+	backplanePublishTimeout = 5 * time.Second
+)
+
+// Backplane relays broadcasts between hubs running in different processes
+// Every payload published is delivered to all subscribers, including the
+// publishing hub, which ignores its own messages
+type Backplane interface {
+	// Publish sends a payload to every hub sharing the backplane
+	Publish(ctx context.Context, payload []byte) error
+
+	// Subscribe calls deliver for each payload published by any hub until ctx
+	// is done or the subscription fails
+	Subscribe(ctx context.Context, deliver func(payload []byte)) error
+}
+
+// backplaneEnvelope is the wire form of a relayed broadcast
+type backplaneEnvelope struct {
+	// Instance identifies the publishing hub so it can skip its own messages
+	Instance    string `json:"instance"`
+	MessageType int    `json:"message_type"`
+	Data        []byte `json:"data"`
+}
+
+// relay queues a locally originated broadcast for the backplane
+// Non-blocking: the message is dropped from the backplane if the queue is full
+func (h *Hub) relay(message outbound) {
+	if h.config.Backplane == nil {
+		return
+	}
+
+	select {
+	case h.relayQueue <- message:
+	default:
+		h.logger.Warn("WebSocket backplane queue full, dropping message", "bytes", len(message.data))
+	}
+}
+
+// runBackplane publishes local broadcasts and delivers remote ones until the
+// hub shuts down
+func (h *Hub) runBackplane() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-h.done
+		cancel()
+	}()
+
+	go h.publishToBackplane(ctx)
+	go h.subscribeToBackplane(ctx)
+}
+
+// publishToBackplane drains relayQueue into the backplane
+func (h *Hub) publishToBackplane(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-h.relayQueue:
+			payload, err := json.Marshal(backplaneEnvelope{
+				Instance:    h.instanceID,
+				MessageType: message.messageType,
+				Data:        message.data,
+			})
+			if err != nil {
+				h.logger.Error("Error marshaling backplane message", "error", err)
+				continue
+			}
+
+			publishCtx, cancel := context.WithTimeout(ctx, backplanePublishTimeout)
+			if err := h.config.Backplane.Publish(publishCtx, payload); err != nil {
+				h.logger.Error("Error publishing to WebSocket backplane", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// subscribeToBackplane delivers remote broadcasts, resubscribing after errors
+func (h *Hub) subscribeToBackplane(ctx context.Context) {
+	for {
+		err := h.config.Backplane.Subscribe(ctx, h.receiveRemote)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Error("WebSocket backplane subscription failed, retrying", "error", err, "retry_in", backplaneRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backplaneRetryDelay):
+		}
+	}
+}
+
+// receiveRemote fans a broadcast from another hub out to local clients
+// It is never relayed again, so messages can't loop between hubs
+func (h *Hub) receiveRemote(payload []byte) {
+	var envelope backplaneEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		h.logger.Warn("Ignoring malformed backplane message", "error", err)
+		return
+	}
+	if envelope.Instance == h.instanceID {
+		return
+	}
+
+	message := outbound{data: envelope.Data, messageType: envelope.MessageType}
+	if !h.enqueue(broadcastRequest{message: message}) {
+		h.logger.Warn("WebSocket broadcast channel full, dropping backplane message", "bytes", len(envelope.Data))
+	}
+}
@@ -0,0 +1,39 @@
+package websocket
+
+// OnBackpressure registers a callback invoked with true when the broadcast
+// channel first overflows and a message is dropped, and with false once it
+// has drained below Config.BroadcastLowWater percent of its capacity; it
+// fires on those transitions only, not on every drop, e.g. to drive a
+// producer-side circuit breaker. The true call runs on the broadcasting
+// goroutine and the false call on the hub goroutine, so it must be quick and
+// must not broadcast with BlockOnFull
+// Must be called before broadcasting
+func (h *Hub) OnBackpressure(fn func(full bool)) {
+	h.onBackpressure = fn
+}
+
+// overflowed records that a broadcast was dropped for lack of room
+func (h *Hub) overflowed() {
+	if !h.backpressured.CompareAndSwap(false, true) {
+		return
+	}
+	h.logger.Warn("WebSocket broadcast channel full, dropping broadcasts", "capacity", cap(h.broadcast))
+	if h.onBackpressure != nil {
+		h.onBackpressure(true)
+	}
+}
+
+// checkRecovered clears the backpressure state once the broadcast channel
+// has drained below the low-water mark; called from the hub loop
+func (h *Hub) checkRecovered() {
+	if !h.backpressured.Load() || len(h.broadcast)*100 >= cap(h.broadcast)*h.config.BroadcastLowWater {
+		return
+	}
+	if !h.backpressured.CompareAndSwap(true, false) {
+		return
+	}
+	h.logger.Info("WebSocket broadcast channel recovered", "depth", len(h.broadcast))
+	if h.onBackpressure != nil {
+		h.onBackpressure(false)
+	}
+}
@@ -0,0 +1,81 @@
+package websocket_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// fullHub returns a hub that isn't running, with its one-slot broadcast
+// channel already filled
+func fullHub(t *testing.T, cfg ws.Config) *ws.Hub {
+	t.Helper()
+	cfg.BroadcastBuffer = 1
+	hub, err := ws.NewHubWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	if err := hub.BroadcastMessage("first", nil); err != nil {
+		t.Fatalf("BroadcastMessage: %v", err)
+	}
+	return hub
+}
+
+func TestDropOnFullDropsAndCounts(t *testing.T) {
+	hub := fullHub(t, ws.Config{})
+
+	if err := hub.BroadcastMessage("second", nil); !errors.Is(err, ws.ErrBroadcastFull) {
+		t.Fatalf("BroadcastMessage = %v, want ErrBroadcastFull", err)
+	}
+	stats := hub.Stats()
+	if stats.MessagesBroadcast != 1 || stats.MessagesDropped != 1 || stats.BroadcastBlockTimeouts != 0 {
+		t.Fatalf("stats = %d broadcast, %d dropped, %d timeouts; want 1, 1, 0",
+			stats.MessagesBroadcast, stats.MessagesDropped, stats.BroadcastBlockTimeouts)
+	}
+}
+
+func TestBlockOnFullTimesOutAndCounts(t *testing.T) {
+	const timeout = 30 * time.Millisecond
+	hub := fullHub(t, ws.Config{BroadcastMode: ws.BlockOnFull, BlockTimeout: timeout})
+
+	start := time.Now()
+	if err := hub.BroadcastMessage("second", nil); !errors.Is(err, ws.ErrBroadcastFull) {
+		t.Fatalf("BroadcastMessage = %v, want ErrBroadcastFull", err)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Fatalf("BroadcastMessage returned after %s, want it to wait %s", waited, timeout)
+	}
+	stats := hub.Stats()
+	if stats.MessagesDropped != 1 || stats.BroadcastBlockTimeouts != 1 {
+		t.Fatalf("stats = %d dropped, %d timeouts; want 1 and 1", stats.MessagesDropped, stats.BroadcastBlockTimeouts)
+	}
+}
+
+func TestBlockOnFullWaitsForRoom(t *testing.T) {
+	hub := fullHub(t, ws.Config{BroadcastMode: ws.BlockOnFull})
+
+	sent := make(chan error, 1)
+	go func() { sent <- hub.BroadcastMessage("second", nil) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("BroadcastMessage returned %v while the channel was full", err)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	// Running the hub drains the channel and lets the producer through
+	go hub.Run()
+	defer hub.Shutdown()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("BroadcastMessage: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BroadcastMessage still blocked after the hub started")
+	}
+	if stats := hub.Stats(); stats.MessagesBroadcast != 2 || stats.MessagesDropped != 0 {
+		t.Fatalf("stats = %d broadcast, %d dropped; want 2 and 0", stats.MessagesBroadcast, stats.MessagesDropped)
+	}
+}
@@ -0,0 +1,256 @@
+package websocket
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Reasons reported to the OnBatchFlush callback
+const (
+	BatchFlushSize     = "size"
+	BatchFlushTimer    = "timer"
+	BatchFlushShutdown = "shutdown"
+)
+
+// batchMessageType is the message type of a flushed batch
+const batchMessageType = "batch"
+
+// typeBatch holds the pending events of a single type and the timer that flushes them
+type typeBatch struct {
+	messages []Message
+	timer    *time.Timer
+
+	// Coalescing key of each message, parallel to messages (coalescing types only)
+	keys []string
+
+	// When each message was added, parallel to messages
+	added []time.Time
+
+	// local batches are neither relayed nor numbered (see broadcastRequest.local)
+	local bool
+}
+
+// BatchLatencyStats is how long batched events waited before their batch
+// was flushed, over every flush so far
+type BatchLatencyStats struct {
+	Avg time.Duration `json:"avg_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// CoalesceKeyFunc extracts the key under which batched events of one type
+// replace each other; events with different keys are all kept
+type CoalesceKeyFunc func(data interface{}) string
+
+// add appends message to the batch; with coalesce set, an earlier message
+// with the same key is dropped so only the latest value survives
+func (b *typeBatch) add(message Message, coalesce bool, key string) {
+	if !coalesce {
+		b.messages = append(b.messages, message)
+		b.added = append(b.added, time.Now())
+		return
+	}
+
+	if i := slices.Index(b.keys, key); i >= 0 {
+		b.messages = slices.Delete(b.messages, i, i+1)
+		b.keys = slices.Delete(b.keys, i, i+1)
+		b.added = slices.Delete(b.added, i, i+1)
+	}
+	b.messages = append(b.messages, message)
+	b.keys = append(b.keys, key)
+	b.added = append(b.added, time.Now())
+}
+
+// BroadcastMessageBatched batches high-frequency events to reduce client load
+// Each event type is batched independently for Config.BatchWindow (50ms by
+// default) or until its batch reaches Config.MaxBatchSize messages, so every
+// flushed batch is type-homogeneous and names its type in BatchType
+// Events are numbered when batched, so a batch may arrive after broadcasts
+// with higher sequence numbers
+// Types listed in Config.CoalesceTypes keep only the latest event per key
+// A batch is one frame, so events too small to compress alone are compressed
+// together; Stats.BatchCompressionRatio samples the saving
+// Events failing their type's validator are logged and dropped
+// This is thread-safe and non-blocking
+func (h *Hub) BroadcastMessageBatched(eventType string, data interface{}) {
+	h.addToBatch(eventType, data, false)
+}
+
+// addToBatch adds an event to its type's batch, flushing the batch once full
+// or starting its timer; local events are left unnumbered, and a batch is
+// local if its first event was
+func (h *Hub) addToBatch(eventType string, data interface{}, local bool) {
+	if err := h.validate(eventType, data); err != nil {
+		h.logger.Error("Dropping invalid batched WebSocket message", "type", eventType, "error", err)
+		return
+	}
+
+	h.batchMutex.Lock()
+
+	message := Message{
+		Type: eventType,
+		Data: data,
+	}
+	if !local {
+		message.Seq = h.nextSeq()
+	}
+
+	batch, ok := h.batches[eventType]
+	if !ok {
+		batch = &typeBatch{messages: make([]Message, 0, h.config.MaxBatchSize), local: local}
+		h.batches[eventType] = batch
+	}
+	keyFunc, coalesce := h.config.CoalesceTypes[eventType]
+	var key string
+	if coalesce && keyFunc != nil {
+		key = keyFunc(data)
+	}
+	batch.add(message, coalesce, key)
+
+	// Flush if batch is full
+	if len(batch.messages) >= h.config.MaxBatchSize {
+		h.flushBatch(eventType, BatchFlushSize) // flushBatch maintains the lock
+		h.batchMutex.Unlock()
+		return
+	}
+
+	// Start timer if this is the first message in the batch
+	if batch.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(h.config.BatchWindow, func() {
+			h.batchMutex.Lock()
+			// Double-check this timer still owns the batch (might have been flushed by size)
+			if b, ok := h.batches[eventType]; ok && b.timer == timer {
+				h.flushBatch(eventType, BatchFlushTimer) // flushBatch maintains the lock
+			}
+			h.batchMutex.Unlock()
+		})
+		batch.timer = timer
+	}
+
+	h.batchMutex.Unlock()
+}
+
+// flushAllBatches flushes every pending batch
+func (h *Hub) flushAllBatches(reason string) {
+	h.batchMutex.Lock()
+	defer h.batchMutex.Unlock()
+
+	// Collect types first since flushBatch releases the lock mid-flush
+	eventTypes := make([]string, 0, len(h.batches))
+	for eventType := range h.batches {
+		eventTypes = append(eventTypes, eventType)
+	}
+	for _, eventType := range eventTypes {
+		h.flushBatch(eventType, reason) // flushBatch maintains the lock
+	}
+}
+
+// flushBatch sends all batched messages of one type at once
+// Must be called with batchMutex already locked
+// The mutex remains locked after this function returns
+// reason is reported to the OnBatchFlush callback
+func (h *Hub) flushBatch(eventType, reason string) {
+	batch, ok := h.batches[eventType]
+	if !ok {
+		return
+	}
+
+	// Stop and clear timer before flushing
+	if batch.timer != nil {
+		batch.timer.Stop()
+	}
+
+	// Detach the batch to avoid holding lock during channel send
+	delete(h.batches, eventType)
+	buffer := batch.messages
+	if len(buffer) == 0 {
+		return
+	}
+
+	// Unlock before potentially blocking channel operation
+	h.batchMutex.Unlock()
+
+	h.recordBatchLatency(batch.added)
+
+	// Notify outside the mutex so the callback may safely call back into the hub
+	if h.onBatchFlush != nil {
+		h.onBatchFlush(len(buffer), reason)
+	}
+
+	// Send all batched messages as a single batch, carrying the sequence
+	// number of its newest event
+	batchMessage := Message{
+		Type:      batchMessageType,
+		BatchType: eventType,
+		Data:      buffer,
+		Seq:       buffer[len(buffer)-1].Seq,
+	}
+
+	ctx, span := h.startSpan(context.Background(), "websocket.batch_flush", &batchMessage,
+		attribute.String("websocket.batch_type", eventType),
+		attribute.Int("websocket.batch_size", len(buffer)),
+		attribute.String("websocket.flush_reason", reason))
+	defer span.End()
+
+	ok, err := h.publish(ctx, batchMessage, broadcastRequest{local: batch.local})
+	if err != nil {
+		spanError(span, err)
+		h.logger.Error("Error marshaling batched WebSocket message", "type", eventType, "error", err)
+		h.batchMutex.Lock()
+		return
+	}
+
+	if ok {
+		h.countEventType(eventType, len(buffer))
+		h.sampleBatchCompression(h.counters.batchesFlushed.Add(1), batchMessage)
+	} else {
+		spanDropped(span, "broadcast channel full")
+		h.logger.Warn("WebSocket broadcast channel full, dropping batch", "type", eventType, "batch_size", len(buffer))
+	}
+
+	// Re-lock mutex before returning
+	h.batchMutex.Lock()
+}
+
+// recordBatchLatency adds how long each of a flushed batch's messages
+// waited to the batch latency counters; called without the batch lock held
+func (h *Hub) recordBatchLatency(added []time.Time) {
+	now := time.Now()
+	var total, longest time.Duration
+	for _, at := range added {
+		wait := now.Sub(at)
+		total += wait
+		longest = max(longest, wait)
+	}
+	h.counters.batchWaitTotal.Add(uint64(total))
+	h.counters.batchWaitCount.Add(uint64(len(added)))
+	for {
+		current := h.counters.batchWaitMax.Load()
+		if uint64(longest) <= current || h.counters.batchWaitMax.CompareAndSwap(current, uint64(longest)) {
+			return
+		}
+	}
+}
+
+// batchLatencyStats averages the recorded batch waits
+func (h *Hub) batchLatencyStats() BatchLatencyStats {
+	count := h.counters.batchWaitCount.Load()
+	if count == 0 {
+		return BatchLatencyStats{}
+	}
+	return BatchLatencyStats{
+		Avg: time.Duration(h.counters.batchWaitTotal.Load() / count),
+		Max: time.Duration(h.counters.batchWaitMax.Load()),
+	}
+}
+
+// OnBatchFlush registers a callback invoked each time BroadcastMessageBatched
+// flushes, with the number of messages and why it flushed (BatchFlushSize,
+// BatchFlushTimer or BatchFlushShutdown). It runs without the batch lock held
+// Must be called before broadcasting
+func (h *Hub) OnBatchFlush(fn func(count int, reason string)) {
+	h.onBatchFlush = fn
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import "encoding/json"
+
+// capabilitiesMessageType is sent by a client to declare what it understands
+const capabilitiesMessageType = "capabilities"
+
+// capabilitiesData is the payload of a capabilities message
+type capabilitiesData struct {
+	Version int `json:"version"`
+}
+
+// Version returns the protocol version the client declared in a
+// capabilities message ({"type":"capabilities","data":{"version":2}}), or
+// zero if it hasn't sent one
+func (c *Client) Version() int {
+	return int(c.version.Load())
+}
+
+// requestCapabilities records a capabilities message from the client
+// Returns false if the message is not a capabilities declaration
+func (c *Client) requestCapabilities(msg Message) bool {
+	if msg.Type != capabilitiesMessageType {
+		return false
+	}
+
+	var data capabilitiesData
+	raw, _ := msg.Data.(json.RawMessage)
+	if err := json.Unmarshal(raw, &data); err != nil || data.Version < 0 {
+		c.log.Warn("WebSocket client sent malformed capabilities", "error", err)
+		return true
+	}
+	c.version.Store(int64(data.Version))
+	return true
+}
+
+// BroadcastIf sends a message to every client that declared at least
+// minVersion; older clients, and those that never declared a version,
+// don't receive it. Returns the number of clients it was queued to
+func (h *Hub) BroadcastIf(minVersion int, eventType string, data interface{}) int {
+	return h.BroadcastFunc(func(c *Client) bool {
+		return c.Version() >= minVersion
+	}, eventType, data)
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import "time"
+
+// ClientInfo is a read-only snapshot of a connected client's metadata
+type ClientInfo struct {
+	ID          string            `json:"id"`
+	UserID      string            `json:"user_id,omitempty"`
+	RemoteAddr  string            `json:"remote_addr"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	Topics      []string          `json:"topics"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	QueueDepth  int               `json:"queue_depth"`
+
+	// LastActivity is when a message was last sent to or received from the
+	// client (what IdleTimeout measures); LastPong is when the connection last
+	// answered a ping. A recent pong with old activity is a connection that
+	// is alive but idle
+	LastActivity time.Time `json:"last_activity"`
+	LastPong     time.Time `json:"last_pong,omitzero"`
+}
+
+// Clients returns metadata for every connected client
+// The result is a copy; it never exposes the live clients
+func (h *Hub) Clients() []ClientInfo {
+	clients := h.snapshot()
+
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, c := range clients {
+		infos = append(infos, ClientInfo{
+			ID:          c.id,
+			UserID:      c.userID,
+			RemoteAddr:  c.remoteAddr,
+			ConnectedAt: c.connectedAt,
+			Topics:      c.Topics(),
+			Tags:        c.Tags(),
+			QueueDepth:  len(c.send),
+
+			LastActivity: unixNanoTime(c.lastActivity.Load()),
+			LastPong:     unixNanoTime(c.lastPong.Load()),
+		})
+	}
+	return infos
+}
+
+// unixNanoTime converts a UnixNano timestamp, leaving zero as the zero Time
+func unixNanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Range calls fn for each connected client until fn returns false
+// It works on a snapshot taken when Range is called, and no hub lock is held
+// while fn runs, so fn may call back into the hub, e.g. to Kick or Close the
+// client or send to it. Clients that connect during Range are not visited;
+// ones that disconnect may still be, and sends to them are no-ops
+func (h *Hub) Range(fn func(c *Client) bool) {
+	for _, c := range h.snapshot() {
+		if !fn(c) {
+			return
+		}
+	}
+}
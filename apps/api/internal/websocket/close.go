@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes sent by the hub and what clients should do about them:
+//
+//	1000 CloseNormalClosure     idle timeout; reconnect when there's activity
+//	1008 ClosePolicyViolation   kicked, rate limited, replaced by a newer
+//	                            connection with the same ID or no hello in
+//	                            time; don't reconnect automatically
+//	1011 CloseInternalServerErr server error; reconnect with backoff
+//	1012 CloseServiceRestart    shutdown, drain or max connection age; reconnect
+//	                            after the retry hint, ideally to another instance
+//	1013 CloseTryAgainLater     client too slow to keep up, or server too busy to
+//	                            register it; reconnect with backoff
+//
+// With Config.SendCloseNotice set, a {"type":"close"} message carrying a
+// CloseNotice is sent just before the close frame
+const closeNoticeType = "close"
+
+// slowClientReason is sent in the close frame when a slow client is evicted
+const slowClientReason = "client too slow"
+
+// CloseNotice tells a client why it is being disconnected and when to reconnect
+type CloseNotice struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+
+	// Reconnect reports whether the client should reconnect automatically
+	Reconnect bool `json:"reconnect"`
+
+	// RetryAfterMs is how long to wait before reconnecting, in milliseconds
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+// retryHint maps a close code to the reconnect advice sent in a CloseNotice
+func (h *Hub) retryHint(code int) (reconnect bool, after time.Duration) {
+	switch code {
+	case websocket.ClosePolicyViolation:
+		return false, 0
+	case websocket.CloseNormalClosure:
+		return true, 0
+	default:
+		return true, h.config.RetryAfter
+	}
+}
+
+// writeCloseNotice sends the CloseNotice for the client's close code ahead of
+// the close frame; write errors are left to the close frame write
+func (c *Client) writeCloseNotice() {
+	c.mu.Lock()
+	code, reason := c.closeCode, c.closeReason
+	c.mu.Unlock()
+	if code == 0 {
+		return
+	}
+
+	reconnect, after := c.hub.retryHint(code)
+	notice, err := json.Marshal(Message{
+		Type: closeNoticeType,
+		Data: CloseNotice{
+			Code:         code,
+			Reason:       reason,
+			Reconnect:    reconnect,
+			RetryAfterMs: after.Milliseconds(),
+		},
+	})
+	if err != nil {
+		return
+	}
+	c.conn.WriteMessage(websocket.TextMessage, notice)
+}
+
+// Close disconnects the client with the given close code and reason, e.g.
+// from a message handler enforcing protocol rules. Messages already queued
+// are written first, then the close frame. A zero code uses
+// ClosePolicyViolation. Safe to call more than once and from any goroutine;
+// only the first call has an effect
+func (c *Client) Close(code int, reason string) {
+	if code == 0 {
+		code = websocket.ClosePolicyViolation
+	}
+	if c.hub.closeClient(c, code, reason) {
+		c.log.Info("WebSocket client closed by server", "code", code, "reason", reason)
+	}
+}
+
+// isClosed reports whether the hub has closed the client
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// awaitCloseReply waits, for up to the shutdown grace period, for the client
+// to answer the close frame writePump just sent before the connection is closed
+func (c *Client) awaitCloseReply() {
+	grace := time.Duration(c.hub.closeGrace.Load())
+	if grace <= 0 {
+		return
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-c.readDone:
+	case <-timer.C:
+	}
+}
+
+// ShutdownGraceful shuts down the hub like Shutdown, but after sending each
+// client its close frame waits up to grace for the client to answer with
+// its own, completing the close handshake, before closing the connection
+// Returns how many clients answered and how many were closed without
+// answering (including those that didn't drain in time)
+func (h *Hub) ShutdownGraceful(grace time.Duration) (acknowledged, forced int) {
+	for _, client := range h.shutdown(shutdownReason, grace) {
+		if client.peerClosed.Load() {
+			acknowledged++
+		} else {
+			forced++
+		}
+	}
+	return acknowledged, forced
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec encodes hub messages for the wire
+// Implementations must be safe for concurrent use
+type Codec interface {
+	Marshal(msg Message) ([]byte, error)
+}
+
+// BinaryCodec is implemented by codecs whose output isn't UTF-8 text, such as
+// MessagePack or Protobuf; when Binary reports true, messages go out as binary frames
+type BinaryCodec interface {
+	Codec
+	Binary() bool
+}
+
+// BatchCodec is implemented by codecs with an envelope of their own for
+// BroadcastMessageBatched batches, e.g. a protobuf message with a repeated
+// field. Without it a batch is passed to Marshal as a Message whose Data is
+// the []Message. Either way the batch goes out as a single frame
+type BatchCodec interface {
+	Codec
+	MarshalBatch(batch Message, messages []Message) ([]byte, error)
+}
+
+// JSONCodec encodes messages as JSON text frames (the default)
+type JSONCodec struct{}
+
+// Marshal encodes msg as JSON
+func (JSONCodec) Marshal(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// encode marshals msg with the hub's codec into a frame ready for delivery
+// A panicking codec is reported as an error rather than crashing the caller
+func (h *Hub) encode(msg Message) (frame outbound, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			frame, err = outbound{}, fmt.Errorf("websocket: codec panicked: %v", r)
+		}
+	}()
+
+	if err := h.validate(msg.Type, msg.Data); err != nil {
+		return outbound{}, err
+	}
+
+	data, err := h.marshal(msg)
+	if err != nil {
+		return outbound{}, err
+	}
+	if bc, ok := h.config.Codec.(BinaryCodec); ok && bc.Binary() {
+		return outbound{data: data, messageType: websocket.BinaryMessage}, nil
+	}
+	return textMessage(data), nil
+}
+
+// marshal encodes msg with the hub's codec, using its batch envelope for
+// batches when it has one
+func (h *Hub) marshal(msg Message) ([]byte, error) {
+	if bc, ok := h.config.Codec.(BatchCodec); ok && msg.Type == batchMessageType {
+		if messages, ok := msg.Data.([]Message); ok {
+			return bc.MarshalBatch(msg, messages)
+		}
+	}
+	return h.config.Codec.Marshal(msg)
+}
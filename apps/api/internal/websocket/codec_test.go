@@ -0,0 +1,23 @@
+package websocket
+
+import "testing"
+
+// benchMessage is a typical telemetry broadcast
+var benchMessage = Message{
+	Type: "agent_status",
+	Data: map[string]any{
+		"agent_id": "agent-42",
+		"status":   "running",
+		"tokens":   18234,
+		"tools":    []string{"search", "shell", "editor"},
+	},
+}
+
+func BenchmarkJSONCodec(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := (JSONCodec{}).Marshal(benchMessage); err != nil {
+			b.Fatalf("Marshal: %v", err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// One in this many batch flushes is measured for Stats.BatchCompressionRatio
+const batchCompressionSampleInterval = 16
+
+// countingConn counts the bytes written to the network, so the size of
+// compressed frames can be compared with the payloads they carry
+type countingConn struct {
+	net.Conn
+	written atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// countingResponseWriter hands the upgrader a countingConn when it hijacks
+// the connection
+type countingResponseWriter struct {
+	http.ResponseWriter
+	conn *countingConn
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("websocket: response does not implement http.Hijacker")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &countingConn{Conn: conn}
+	return w.conn, brw, nil
+}
+
+// offersCompression reports whether the upgrade will negotiate permessage-deflate
+func (h *Hub) offersCompression(r *http.Request) bool {
+	if !h.upgrader.EnableCompression {
+		return false
+	}
+	for _, ext := range r.Header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(ext, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// startWrite enables compression for a message that is worth compressing and
+// returns whether it did, with the bytes written so far for finishWrite
+func (c *Client) startWrite(message outbound) (compressed bool, written int64) {
+	// Skip compression for small payloads and messages that opted out
+	compressed = c.compression && !message.noCompress &&
+		len(message.data) >= c.hub.config.CompressionThreshold
+	c.conn.EnableWriteCompression(compressed)
+	return compressed, c.wire.written.Load()
+}
+
+// finishWrite counts a compressed write's payload and wire sizes for Stats
+func (c *Client) finishWrite(compressed bool, payload int, written int64) {
+	if !compressed {
+		return
+	}
+	c.hub.counters.compressionIn.Add(uint64(payload))
+	c.hub.counters.compressionOut.Add(uint64(c.wire.written.Load() - written))
+}
+
+// compressionRatio returns compressed bytes written per payload byte
+// (below 1 when compression helps), or zero before anything was compressed
+func (h *Hub) compressionRatio() float64 {
+	in := h.counters.compressionIn.Load()
+	if in == 0 {
+		return 0
+	}
+	return float64(h.counters.compressionOut.Load()) / float64(in)
+}
+
+// sampleBatchCompression compares, for one in batchCompressionSampleInterval
+// flushes, the size a batch is sent at with the total size of its events
+// sent one by one, each compressed on its own if over CompressionThreshold
+// flushes is the flush count including this one
+func (h *Hub) sampleBatchCompression(flushes uint64, batch Message) {
+	events, ok := batch.Data.([]Message)
+	if h.config.DisableCompression || !ok || flushes%batchCompressionSampleInterval != 1 {
+		return
+	}
+
+	batched, err := h.marshal(batch)
+	if err != nil {
+		return
+	}
+	var unbatched int
+	for _, event := range events {
+		data, err := h.config.Codec.Marshal(event)
+		if err != nil {
+			return
+		}
+		unbatched += h.sentSize(data)
+	}
+	h.counters.batchFrameBytes.Add(uint64(h.sentSize(batched)))
+	h.counters.batchUnbatchedBytes.Add(uint64(unbatched))
+}
+
+// sentSize estimates the payload size of a message on a compressing
+// connection: deflated (as permessage-deflate does, without the sync
+// trailer) when over CompressionThreshold, raw otherwise
+func (h *Hub) sentSize(data []byte) int {
+	if len(data) < h.config.CompressionThreshold {
+		return len(data)
+	}
+
+	var counter byteCounter
+	fw, _ := h.flateWriters.Get().(*flate.Writer)
+	if fw == nil {
+		var err error
+		if fw, err = flate.NewWriter(&counter, h.config.CompressionLevel); err != nil {
+			return len(data)
+		}
+	} else {
+		fw.Reset(&counter)
+	}
+	defer h.flateWriters.Put(fw)
+
+	fw.Write(data)
+	fw.Flush()
+	return max(int(counter)-4, 0)
+}
+
+// byteCounter is an io.Writer that only counts what is written to it
+type byteCounter int
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
+
+// batchCompressionRatio returns sampled batch bytes sent per byte the same
+// events would take sent individually, or zero before any sample
+func (h *Hub) batchCompressionRatio() float64 {
+	unbatched := h.counters.batchUnbatchedBytes.Load()
+	if unbatched == 0 {
+		return 0
+	}
+	return float64(h.counters.batchFrameBytes.Load()) / float64(unbatched)
+}
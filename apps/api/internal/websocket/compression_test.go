@@ -0,0 +1,109 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// dialCompressed connects to hub over a real socket, offering permessage-deflate
+// The in-memory wstest server doesn't negotiate extensions
+func dialCompressed(t *testing.T, hub *ws.Hub) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(hub.ServeWS))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Fatal("permessage-deflate was not negotiated")
+	}
+
+	waitFor(t, "the client to register", func() bool { return hub.GetClientCount() == 1 })
+	return conn
+}
+
+func TestLargeMessagesAreCompressed(t *testing.T) {
+	hub, _ := startHub(t, ws.Config{})
+	conn := dialCompressed(t, hub)
+
+	payload := strings.Repeat("agent status nominal; ", 1000)
+	if err := hub.BroadcastMessage("log", payload); err != nil {
+		t.Fatalf("BroadcastMessage: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	var msg struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Data != payload {
+		t.Fatalf("payload did not survive the round trip (err %v)", err)
+	}
+
+	// The write is counted once it completes, which may be after the read
+	waitFor(t, "the write to be counted", func() bool { return hub.Stats().CompressionBytesOut > 0 })
+	stats := hub.Stats()
+	if stats.CompressionBytesIn < uint64(len(payload)) {
+		t.Fatalf("CompressionBytesIn = %d, want at least %d", stats.CompressionBytesIn, len(payload))
+	}
+	if stats.CompressionBytesOut >= stats.CompressionBytesIn/10 {
+		t.Fatalf("CompressionBytesOut = %d for %d bytes in, want it compressed",
+			stats.CompressionBytesOut, stats.CompressionBytesIn)
+	}
+}
+
+func TestSmallMessagesAreNotCompressed(t *testing.T) {
+	hub, _ := startHub(t, ws.Config{})
+	conn := dialCompressed(t, hub)
+
+	if err := hub.BroadcastMessage("log", "short"); err != nil {
+		t.Fatalf("BroadcastMessage: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	if in := hub.Stats().CompressionBytesIn; in != 0 {
+		t.Fatalf("CompressionBytesIn = %d, want 0 below CompressionThreshold", in)
+	}
+}
+
+func TestNoCompressOptionSkipsCompression(t *testing.T) {
+	hub, _ := startHub(t, ws.Config{})
+	conn := dialCompressed(t, hub)
+
+	payload := strings.Repeat("already compressed; ", 1000)
+	if err := hub.BroadcastWithOptions(ws.BroadcastOptions{NoCompress: true}, "blob", payload); err != nil {
+		t.Fatalf("BroadcastWithOptions: %v", err)
+	}
+	hub.BroadcastBinary([]byte(payload), ws.BroadcastOptions{NoCompress: true})
+
+	for _, want := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		messageType, _, err := conn.ReadMessage()
+		if err != nil || messageType != want {
+			t.Fatalf("ReadMessage = type %d, %v; want type %d", messageType, err, want)
+		}
+	}
+
+	waitFor(t, "the writes to be counted", func() bool { return hub.Stats().MessagesWritten == 2 })
+	if in := hub.Stats().CompressionBytesIn; in != 0 {
+		t.Fatalf("CompressionBytesIn = %d, want 0 with NoCompress", in)
+	}
+}
@@ -0,0 +1,569 @@
+package websocket
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// DefaultWriteWait is the time allowed to write a message to the peer
+	DefaultWriteWait = 10 * time.Second
+
+	// DefaultPongWait is the time allowed to read the next pong message from the peer
+	DefaultPongWait = 60 * time.Second
+
+	// DefaultPingPeriod is how often pings are sent (must be less than the pong wait)
+	DefaultPingPeriod = (DefaultPongWait * 9) / 10
+
+	// DefaultCompressionLevel favors speed, matching gorilla/websocket's default
+	DefaultCompressionLevel = flate.BestSpeed
+
+	// DefaultMaxMessageSize is the largest message accepted from a client, in bytes
+	DefaultMaxMessageSize = 512 * 1024
+
+	// DefaultStreamChunkSize is the largest chunk SendStream puts in one message
+	DefaultStreamChunkSize = 32 * 1024
+
+	// DefaultCompressionThreshold is the smallest message (in bytes) worth compressing
+	DefaultCompressionThreshold = 1024
+
+	// DefaultBroadcastBuffer is the capacity of the hub's broadcast channel
+	DefaultBroadcastBuffer = 256
+
+	// DefaultBroadcastHighWater is the broadcast queue fill percentage that logs a warning
+	DefaultBroadcastHighWater = 80
+
+	// DefaultBroadcastLowWater is the fill percentage a full broadcast queue
+	// must drain below to count as recovered
+	DefaultBroadcastLowWater = 50
+
+	// DefaultClientSendBuffer is the capacity of each client's send channel
+	DefaultClientSendBuffer = 256
+
+	// DefaultHighPrioritySendBuffer is the capacity of each client's high-priority lane
+	DefaultHighPrioritySendBuffer = 32
+
+	// DefaultReadBufferSize and DefaultWriteBufferSize size each connection's I/O buffers
+	DefaultReadBufferSize  = 1024
+	DefaultWriteBufferSize = 1024
+
+	// DefaultBatchWindow is how long BroadcastMessageBatched collects events
+	DefaultBatchWindow = 50 * time.Millisecond
+
+	// DefaultMaxBatchSize is the batch size that triggers an immediate flush
+	DefaultMaxBatchSize = 10
+
+	// DefaultHeartbeatInterval is how often heartbeats are sent when enabled
+	DefaultHeartbeatInterval = 30 * time.Second
+
+	// DefaultRegisterTimeout is how long ServeWS waits to register a new client
+	DefaultRegisterTimeout = 5 * time.Second
+
+	// DefaultHelloTimeout is how long a client has to say hello under RequireHello
+	DefaultHelloTimeout = 10 * time.Second
+
+	// DefaultMaxCoalescedMessages is the most queued messages written in one frame
+	DefaultMaxCoalescedMessages = 32
+
+	// DefaultRetryAfter is the reconnect delay suggested to clients closed by a restart
+	DefaultRetryAfter = time.Second
+
+	// DefaultHealthSaturationTimeout is how long the broadcast queue may stay
+	// near capacity before the hub reports itself unhealthy
+	DefaultHealthSaturationTimeout = 30 * time.Second
+
+	// DefaultAckTimeout is how long a client has to acknowledge a message
+	DefaultAckTimeout = 10 * time.Second
+
+	// DefaultInboundRateLimitMaxDrops is how many rate-limited messages within
+	// ten seconds get a client disconnected
+	DefaultInboundRateLimitMaxDrops = 50
+)
+
+// DefaultAllowedOrigins are the origins accepted when none are configured
+var DefaultAllowedOrigins = []string{
+	"http://localhost:5173",
+	"http://localhost:3000",
+	"http://127.0.0.1:5173",
+	"http://127.0.0.1:3000",
+}
+
+// DefaultExpectedCloseCodes are the close codes readPump doesn't log as
+// errors when none are configured
+var DefaultExpectedCloseCodes = []int{
+	websocket.CloseGoingAway,
+	websocket.CloseAbnormalClosure,
+}
+
+// Config holds the tunable settings for a Hub
+type Config struct {
+	// AllowedOrigins lists the origins permitted to open a WebSocket connection
+	// The wildcard entry "*" allows any origin (intended for local development)
+	// Entries may also be host globs such as "https://*.preview.example.com"
+	// Defaults to DefaultAllowedOrigins when empty
+	AllowedOrigins []string
+
+	// RejectEmptyOrigin refuses upgrade requests without an Origin header
+	// They are allowed by default so non-browser clients can connect; set this
+	// when every legitimate client is a browser
+	RejectEmptyOrigin bool
+
+	// WriteWait is the time allowed to write a message to the peer
+	// Zero uses DefaultWriteWait
+	WriteWait time.Duration
+
+	// PongWait is the time allowed to read the next pong message from the peer;
+	// flaky mobile networks may need a longer wait. Zero uses DefaultPongWait
+	PongWait time.Duration
+
+	// PingPeriod is how often pings are sent and must be less than PongWait
+	// Zero uses nine tenths of PongWait
+	PingPeriod time.Duration
+
+	// PingJitter shortens each ping interval by a random amount of up to this
+	// percentage of PingPeriod, so connections opened together don't ping in
+	// lockstep. Intervals never exceed PingPeriod, keeping them below PongWait
+	// Zero sends pings exactly every PingPeriod
+	PingJitter int
+
+	// DisableCompression turns off permessage-deflate negotiation
+	// Compression is negotiated by default and only used when the client supports it
+	DisableCompression bool
+
+	// DisableCoalescing writes every queued message as its own frame
+	// By default messages queued behind one another share a text frame,
+	// separated by newlines; disable that for clients that JSON.parse each
+	// frame whole
+	DisableCoalescing bool
+
+	// MaxCoalescedMessages caps how many queued messages share one frame, so
+	// a client with a deep backlog doesn't get one huge frame that holds up
+	// its pings and high-priority messages. Zero uses DefaultMaxCoalescedMessages
+	MaxCoalescedMessages int
+
+	// CompressionLevel is the flate level used for compressed messages
+	// (flate.HuffmanOnly through flate.BestCompression); zero uses DefaultCompressionLevel
+	CompressionLevel int
+
+	// CompressionThreshold is the minimum message size in bytes that is compressed;
+	// smaller messages are sent uncompressed to save CPU
+	// Zero uses DefaultCompressionThreshold
+	CompressionThreshold int
+
+	// MaxMessageSize is the largest message in bytes a client may send; bigger
+	// messages close the connection with CloseMessageTooBig and are reported
+	// as EvictMessageTooBig. Zero uses DefaultMaxMessageSize
+	MaxMessageSize int64
+
+	// StreamChunkSize is the number of source bytes SendStream sends per
+	// "chunk" message. Zero uses DefaultStreamChunkSize
+	StreamChunkSize int
+
+	// BroadcastBuffer is the capacity of the hub's broadcast channel
+	// Zero uses DefaultBroadcastBuffer
+	BroadcastBuffer int
+
+	// BroadcastMode chooses what non-blocking broadcasts do when the broadcast
+	// channel is full. The zero value, DropOnFull, drops the message
+	BroadcastMode BroadcastMode
+
+	// BlockTimeout bounds how long a broadcast waits for room under
+	// BlockOnFull before it is dropped and counted in BroadcastBlockTimeouts
+	// Zero waits until there is room or the hub shuts down
+	BlockTimeout time.Duration
+
+	// RegisterTimeout bounds how long ServeWS waits for the Run loop to
+	// register an upgraded connection before closing it with
+	// CloseTryAgainLater, e.g. when Run was never started
+	// Zero uses DefaultRegisterTimeout
+	RegisterTimeout time.Duration
+
+	// BroadcastHighWater is the percentage of BroadcastBuffer above which a
+	// warning is logged (at most every ten seconds), before messages start to
+	// be dropped. Zero uses DefaultBroadcastHighWater
+	BroadcastHighWater int
+
+	// BroadcastLowWater is the percentage of BroadcastBuffer the broadcast
+	// channel must drain below after overflowing before OnBackpressure
+	// reports it recovered. Zero uses DefaultBroadcastLowWater
+	BroadcastLowWater int
+
+	// ClientSendBuffer is the number of messages queued per client before it is
+	// considered slow. Larger buffers tolerate bursts from high-frequency
+	// telemetry but delay eviction of slow clients and cost memory per
+	// connection; smaller buffers detect slow clients sooner
+	// Zero uses DefaultClientSendBuffer
+	ClientSendBuffer int
+
+	// HighPrioritySendBuffer is the number of PriorityHigh messages queued per
+	// client ahead of its send buffer; once full they queue as normal messages
+	// Zero uses DefaultHighPrioritySendBuffer
+	HighPrioritySendBuffer int
+
+	// ReadBufferSize and WriteBufferSize are the per-connection I/O buffer
+	// sizes in bytes. Messages larger than a buffer take several syscalls (and,
+	// when serving wss directly, several TLS records) per frame, so raise them
+	// when messages are routinely large; each connection holds both buffers, so
+	// memory grows with size times connections. Zero uses the defaults
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// ShareWriteBuffers pools write buffers across connections instead of
+	// giving each its own, so idle clients hold no write buffer. This cuts
+	// memory for many mostly-idle connections at the cost of a pool round trip
+	// per write
+	ShareWriteBuffers bool
+
+	// BatchWindow is how long BroadcastMessageBatched collects events before
+	// flushing; longer windows mean fewer, larger frames at the cost of latency
+	// Zero uses DefaultBatchWindow
+	BatchWindow time.Duration
+
+	// MaxBatchSize is the number of batched events that triggers an immediate flush
+	// Zero uses DefaultMaxBatchSize
+	MaxBatchSize int
+
+	// CoalesceTypes lists event types whose batched events replace each other,
+	// e.g. progress updates where only the latest value matters. Each type
+	// maps to a function extracting the coalescing key from the event data;
+	// a nil function keeps only the latest event of the type
+	CoalesceTypes map[string]CoalesceKeyFunc
+
+	// SlowClientTimeout is how long a client's send channel may stay full or
+	// near-full before the client is evicted; messages that don't fit are dropped
+	// in the meantime. Zero evicts a client as soon as its channel is full
+	SlowClientTimeout time.Duration
+
+	// IdleTimeout closes clients that neither received a message nor sent one
+	// for this long; pings and pongs don't count as activity
+	// Zero disables the idle timeout
+	IdleTimeout time.Duration
+
+	// SendCloseNotice sends a {"type":"close"} message with the close code,
+	// reason and a reconnect hint just before the hub closes a connection
+	SendCloseNotice bool
+
+	// ExpectedCloseCodes are the close codes a client may close with without
+	// the hub logging a read error, e.g. websocket.CloseNoStatusReceived for
+	// clients that close without a status. Empty uses DefaultExpectedCloseCodes
+	ExpectedCloseCodes []int
+
+	// RetryAfter is the reconnect delay suggested in close notices for
+	// restarts and errors. Zero uses DefaultRetryAfter
+	RetryAfter time.Duration
+
+	// MaxConnectionAge closes connections with CloseServiceRestart once they
+	// have been open this long, so clients reconnect and load balancers can
+	// rebalance. Zero means connections live indefinitely
+	MaxConnectionAge time.Duration
+
+	// MaxConnectionAgeJitter adds a random extra age of up to this duration to
+	// each connection so clients that connected together don't all reconnect at once
+	MaxConnectionAgeJitter time.Duration
+
+	// EnablePresence broadcasts a "presence" message when clients connect,
+	// disconnect, subscribe or unsubscribe. Connection events go to every
+	// client; topic changes, and departures of subscribed clients, are only
+	// announced to the affected topics' subscribers
+	EnablePresence bool
+
+	// RequireHello withholds every message from a new client until it sends
+	// {"type":"hello"}, optionally with {"version":N,"channels":[...]} data,
+	// so clients still initializing aren't sent anything. Clients that haven't
+	// said hello within HelloTimeout are closed with ClosePolicyViolation
+	// (zero uses DefaultHelloTimeout)
+	RequireHello bool
+	HelloTimeout time.Duration
+
+	// EnableHeartbeat broadcasts {"type":"heartbeat","data":{"ts":...}} (ts
+	// in Unix milliseconds) every HeartbeatInterval, so clients can detect a
+	// dead connection even behind proxies that answer transport pings
+	// themselves. BatchHeartbeats sends them through BroadcastMessageBatched
+	// Heartbeats only go to this instance's clients; they aren't relayed
+	// over the Backplane or numbered for replay
+	EnableHeartbeat   bool
+	HeartbeatInterval time.Duration
+	BatchHeartbeats   bool
+
+	// InboundRateLimit is the sustained number of messages per second a client
+	// may send; excess messages are dropped. Zero disables rate limiting
+	InboundRateLimit float64
+
+	// InboundBurst is the number of messages a client may send in a burst
+	// above InboundRateLimit (minimum 1)
+	InboundBurst int
+
+	// InboundRateLimitMaxDrops is how many rate-limited messages within ten
+	// seconds cause the client to be closed with a policy-violation code
+	// Zero uses DefaultInboundRateLimitMaxDrops
+	InboundRateLimitMaxDrops int
+
+	// HealthSaturationTimeout is how long the broadcast queue may stay above
+	// BroadcastHighWater before HealthHandler reports the hub unhealthy
+	// Zero uses DefaultHealthSaturationTimeout
+	HealthSaturationTimeout time.Duration
+
+	// AckTimeout is how long clients have to acknowledge messages sent with
+	// BroadcastMessageWithAck before OnAckTimeout fires
+	// Zero uses DefaultAckTimeout
+	AckTimeout time.Duration
+
+	// Authenticator, when set, is called before each upgrade; requests it
+	// rejects receive 401 Unauthorized and are never upgraded. The returned
+	// user ID is available from Client.UserID
+	Authenticator Authenticator
+
+	// MaxClients caps the number of concurrent connections; further upgrade
+	// requests are rejected with 503 Service Unavailable
+	// Zero means unlimited
+	MaxClients int
+
+	// MaxConnectionsPerIP caps concurrent connections from a single client IP;
+	// further upgrade requests get 429 Too Many Requests. Zero means unlimited
+	MaxConnectionsPerIP int
+
+	// TrustForwardedHeaders also accepts an origin matching the client-facing
+	// scheme and host from X-Forwarded-Proto and X-Forwarded-Host, so a
+	// TLS-terminating proxy rewriting the request to plain http doesn't cause
+	// same-origin clients to be rejected. Only enable it behind such a proxy
+	TrustForwardedHeaders bool
+
+	// TrustForwardedFor takes the client IP from the first X-Forwarded-For
+	// entry; only enable it behind a proxy that sets the header
+	TrustForwardedFor bool
+
+	// Subprotocols lists the Sec-WebSocket-Protocol values the server supports,
+	// in order of preference; the first one the client also offers is chosen
+	// and available from Client.Subprotocol
+	Subprotocols []string
+
+	// RequireSubprotocol rejects upgrades with 400 Bad Request when the client
+	// offers none of Subprotocols
+	RequireSubprotocol bool
+
+	// ReplayBuffer is the number of recent broadcasts kept so a reconnecting
+	// client can send {"type":"resume","data":{"last_seq":N}} and receive the
+	// broadcasts it missed, identified by their "seq" field. Replays larger
+	// than ClientSendBuffer are cut short
+	// Zero disables replay
+	ReplayBuffer int
+
+	// Backplane, when set, relays broadcasts to hubs in other processes and
+	// delivers theirs to local clients, e.g. a RedisBackplane. Topic, targeted
+	// and predicate sends stay local, and sequence numbers are per hub
+	Backplane Backplane
+
+	// AuditSink, when set, receives connect, disconnect, kick and
+	// authentication failure events
+	AuditSink AuditSink
+
+	// TracerProvider traces broadcasts from enqueue through fan-out, with
+	// spans for batch flushes and events for drops. The trace context is sent
+	// to clients in the message's "trace" field
+	// Defaults to a no-op provider
+	TracerProvider trace.TracerProvider
+
+	// Codec encodes outgoing messages, including batches and presence events
+	// Defaults to JSONCodec; binary codecs such as MessagePack can implement
+	// BinaryCodec to have their output sent as binary frames, and BatchCodec
+	// to give batches an envelope of their own
+	Codec Codec
+
+	// Logger receives the hub's connection, error and drop records
+	// Defaults to slog.Default(), which writes through the standard log package
+	Logger *slog.Logger
+}
+
+// DefaultConfig returns the configuration used by NewHub
+func DefaultConfig() Config {
+	return Config{}.withDefaults()
+}
+
+// withDefaults fills zero-valued fields with their defaults
+func (c Config) withDefaults() Config {
+	if len(c.AllowedOrigins) == 0 {
+		c.AllowedOrigins = DefaultAllowedOrigins
+	}
+	if len(c.ExpectedCloseCodes) == 0 {
+		c.ExpectedCloseCodes = DefaultExpectedCloseCodes
+	}
+	if c.WriteWait == 0 {
+		c.WriteWait = DefaultWriteWait
+	}
+	if c.PongWait == 0 {
+		c.PongWait = DefaultPongWait
+	}
+	if c.PingPeriod == 0 {
+		c.PingPeriod = (c.PongWait * 9) / 10
+	}
+	if c.CompressionLevel == 0 {
+		c.CompressionLevel = DefaultCompressionLevel
+	}
+	if c.CompressionThreshold == 0 {
+		c.CompressionThreshold = DefaultCompressionThreshold
+	}
+	if c.MaxMessageSize == 0 {
+		c.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if c.StreamChunkSize == 0 {
+		c.StreamChunkSize = DefaultStreamChunkSize
+	}
+	if c.BroadcastBuffer == 0 {
+		c.BroadcastBuffer = DefaultBroadcastBuffer
+	}
+	if c.BroadcastHighWater == 0 {
+		c.BroadcastHighWater = DefaultBroadcastHighWater
+	}
+	if c.BroadcastLowWater == 0 {
+		c.BroadcastLowWater = DefaultBroadcastLowWater
+	}
+	if c.ClientSendBuffer == 0 {
+		c.ClientSendBuffer = DefaultClientSendBuffer
+	}
+	if c.HighPrioritySendBuffer == 0 {
+		c.HighPrioritySendBuffer = DefaultHighPrioritySendBuffer
+	}
+	if c.ReadBufferSize == 0 {
+		c.ReadBufferSize = DefaultReadBufferSize
+	}
+	if c.WriteBufferSize == 0 {
+		c.WriteBufferSize = DefaultWriteBufferSize
+	}
+	if c.BatchWindow == 0 {
+		c.BatchWindow = DefaultBatchWindow
+	}
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if c.RegisterTimeout == 0 {
+		c.RegisterTimeout = DefaultRegisterTimeout
+	}
+	if c.MaxCoalescedMessages == 0 {
+		c.MaxCoalescedMessages = DefaultMaxCoalescedMessages
+	}
+	if c.HelloTimeout == 0 {
+		c.HelloTimeout = DefaultHelloTimeout
+	}
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if c.RetryAfter == 0 {
+		c.RetryAfter = DefaultRetryAfter
+	}
+	if c.HealthSaturationTimeout == 0 {
+		c.HealthSaturationTimeout = DefaultHealthSaturationTimeout
+	}
+	if c.AckTimeout == 0 {
+		c.AckTimeout = DefaultAckTimeout
+	}
+	if c.InboundRateLimitMaxDrops == 0 {
+		c.InboundRateLimitMaxDrops = DefaultInboundRateLimitMaxDrops
+	}
+	if c.TracerProvider == nil {
+		c.TracerProvider = noop.NewTracerProvider()
+	}
+	if c.Codec == nil {
+		c.Codec = JSONCodec{}
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	return c
+}
+
+// BroadcastMode selects how broadcasts behave when the broadcast channel is full
+type BroadcastMode int
+
+const (
+	// DropOnFull drops the message, keeping producers from ever waiting
+	DropOnFull BroadcastMode = iota
+
+	// BlockOnFull makes the producer wait for room, slowing it down instead
+	// of losing messages. OnConnect, OnDisconnect and OnClientEvicted
+	// callbacks can run on the hub goroutine that frees that room, so
+	// broadcasts from them need a BlockTimeout to avoid stalling the hub
+	BlockOnFull
+)
+
+// validate reports settings that would misbehave at runtime
+func (c Config) validate() error {
+	if c.WriteWait < 0 || c.PongWait < 0 || c.PingPeriod < 0 {
+		return fmt.Errorf("websocket: write wait, pong wait and ping period must be positive, got %s, %s and %s",
+			c.WriteWait, c.PongWait, c.PingPeriod)
+	}
+	if c.PingPeriod >= c.PongWait {
+		return fmt.Errorf("websocket: ping period %s must be less than pong wait %s", c.PingPeriod, c.PongWait)
+	}
+	if c.PingJitter < 0 || c.PingJitter >= 100 {
+		return fmt.Errorf("websocket: ping jitter must be a percentage below 100, got %d", c.PingJitter)
+	}
+	if c.RegisterTimeout < 0 {
+		return fmt.Errorf("websocket: register timeout must not be negative, got %s", c.RegisterTimeout)
+	}
+	if c.HelloTimeout < 0 {
+		return fmt.Errorf("websocket: hello timeout must not be negative, got %s", c.HelloTimeout)
+	}
+	if c.HeartbeatInterval < 0 {
+		return fmt.Errorf("websocket: heartbeat interval must not be negative, got %s", c.HeartbeatInterval)
+	}
+	if c.BatchWindow <= 0 {
+		return fmt.Errorf("websocket: batch window must be positive, got %s", c.BatchWindow)
+	}
+	if c.BroadcastHighWater < 0 || c.BroadcastHighWater > 100 {
+		return fmt.Errorf("websocket: broadcast high water must be a percentage, got %d", c.BroadcastHighWater)
+	}
+	if c.BroadcastLowWater < 0 || c.BroadcastLowWater > 100 {
+		return fmt.Errorf("websocket: broadcast low water must be a percentage, got %d", c.BroadcastLowWater)
+	}
+	if c.RequireSubprotocol && len(c.Subprotocols) == 0 {
+		return errors.New("websocket: subprotocol required but none configured")
+	}
+	if c.BroadcastMode != DropOnFull && c.BroadcastMode != BlockOnFull {
+		return fmt.Errorf("websocket: unknown broadcast mode %d", c.BroadcastMode)
+	}
+	if c.BlockTimeout < 0 {
+		return fmt.Errorf("websocket: block timeout must not be negative, got %s", c.BlockTimeout)
+	}
+	if c.ReplayBuffer < 0 {
+		return fmt.Errorf("websocket: replay buffer must not be negative, got %d", c.ReplayBuffer)
+	}
+	if c.MaxMessageSize < 0 {
+		return fmt.Errorf("websocket: max message size must not be negative, got %d", c.MaxMessageSize)
+	}
+	if c.StreamChunkSize < 0 {
+		return fmt.Errorf("websocket: stream chunk size must not be negative, got %d", c.StreamChunkSize)
+	}
+	if c.ReadBufferSize <= 0 || c.WriteBufferSize <= 0 {
+		return fmt.Errorf("websocket: buffer sizes must be positive, got read %d write %d", c.ReadBufferSize, c.WriteBufferSize)
+	}
+	if c.BroadcastBuffer <= 0 {
+		return fmt.Errorf("websocket: broadcast buffer must be positive, got %d", c.BroadcastBuffer)
+	}
+	if c.ClientSendBuffer <= 0 || c.HighPrioritySendBuffer <= 0 {
+		return fmt.Errorf("websocket: client send buffers must be positive, got %d and %d high priority",
+			c.ClientSendBuffer, c.HighPrioritySendBuffer)
+	}
+	if c.CompressionLevel < flate.HuffmanOnly || c.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("websocket: compression level must be between %d and %d, got %d",
+			flate.HuffmanOnly, flate.BestCompression, c.CompressionLevel)
+	}
+	if c.MaxCoalescedMessages <= 0 {
+		return fmt.Errorf("websocket: max coalesced messages must be positive, got %d", c.MaxCoalescedMessages)
+	}
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("websocket: max batch size must be positive, got %d", c.MaxBatchSize)
+	}
+	for _, pattern := range c.AllowedOrigins {
+		if _, err := compileOriginRule(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
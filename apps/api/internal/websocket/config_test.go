@@ -0,0 +1,52 @@
+package websocket_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+func TestNewHubWithConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ws.Config
+		want string
+	}{
+		{"ping not below pong", ws.Config{PingPeriod: time.Minute, PongWait: time.Minute}, "ping period"},
+		{"negative write wait", ws.Config{WriteWait: -time.Second}, "must be positive"},
+		{"ping jitter 100", ws.Config{PingJitter: 100}, "ping jitter"},
+		{"negative read buffer", ws.Config{ReadBufferSize: -1}, "buffer sizes"},
+		{"negative broadcast buffer", ws.Config{BroadcastBuffer: -1}, "broadcast buffer"},
+		{"negative send buffer", ws.Config{ClientSendBuffer: -1}, "send buffers"},
+		{"negative batch size", ws.Config{MaxBatchSize: -1}, "batch size"},
+		{"negative batch window", ws.Config{BatchWindow: -time.Second}, "batch window"},
+		{"unknown broadcast mode", ws.Config{BroadcastMode: 7}, "broadcast mode"},
+		{"negative replay buffer", ws.Config{ReplayBuffer: -1}, "replay buffer"},
+		{"low water over 100", ws.Config{BroadcastLowWater: 101}, "low water"},
+		{"compression level", ws.Config{CompressionLevel: 10}, "compression level"},
+		{"subprotocol required", ws.Config{RequireSubprotocol: true}, "subprotocol"},
+		{"bad origin", ws.Config{AllowedOrigins: []string{"*://example.com"}}, "origin pattern"},
+	}
+	for _, tt := range tests {
+		hub, err := ws.NewHubWithConfig(tt.cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: NewHubWithConfig error = %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+		if hub != nil {
+			t.Errorf("%s: NewHubWithConfig returned a hub with its error", tt.name)
+		}
+	}
+}
+
+func TestNewHubWithConfigAcceptsDefaults(t *testing.T) {
+	for name, cfg := range map[string]ws.Config{
+		"zero":    {},
+		"default": ws.DefaultConfig(),
+	} {
+		if _, err := ws.NewHubWithConfig(cfg); err != nil {
+			t.Errorf("%s config: NewHubWithConfig: %v", name, err)
+		}
+	}
+}
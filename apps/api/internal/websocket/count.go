@@ -0,0 +1,32 @@
+package websocket
+
+// Inbound request for the live client count, answered with a count message
+const (
+	getCountMessageType = "get_count"
+	countMessageType    = "count"
+)
+
+// ClientCount is the payload of a count message
+type ClientCount struct {
+	Clients int `json:"clients"`
+}
+
+// requestCount answers {"type":"get_count"} with
+// {"type":"count","data":{"clients":N}} to the asking client
+// Returns false if the message is not a count request
+func (c *Client) requestCount(msg Message) bool {
+	if msg.Type != getCountMessageType {
+		return false
+	}
+
+	frame, err := c.hub.encode(Message{
+		Type: countMessageType,
+		Data: ClientCount{Clients: c.hub.GetClientCount()},
+	})
+	if err != nil {
+		c.log.Error("Error marshaling WebSocket message", "type", countMessageType, "error", err)
+		return true
+	}
+	c.hub.deliver(c, frame)
+	return true
+}
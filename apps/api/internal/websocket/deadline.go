@@ -0,0 +1,35 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errDeadline wraps failures to set a connection deadline, which only happen
+// once the underlying connection is closed
+var errDeadline = errors.New("websocket: setting connection deadline failed")
+
+// setWriteDeadline gives the next write WriteWait to complete
+func (c *Client) setWriteDeadline() error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait)); err != nil {
+		return fmt.Errorf("%w: %w", errDeadline, err)
+	}
+	return nil
+}
+
+// setReadDeadline gives the peer PongWait to send its next message or pong
+func (c *Client) setReadDeadline() error {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait)); err != nil {
+		return fmt.Errorf("%w: %w", errDeadline, err)
+	}
+	return nil
+}
+
+// deadlineFailed disconnects the client after a deadline couldn't be set,
+// rather than carrying on with a connection that can no longer time out
+// It's logged at debug level since the connection is already gone
+func (c *Client) deadlineFailed(err error) {
+	c.log.Debug("WebSocket connection deadline failed, disconnecting client", "error", err)
+	c.hub.closeClient(c, 0, "")
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// How long Shutdown lets clients empty their send buffers
+	shutdownDrainTimeout = time.Second
+
+	// How often Drain checks whether clients have emptied their send buffers
+	drainPollInterval = 10 * time.Millisecond
+
+	// Reason sent in the close frame when the hub drains
+	drainReason = "server draining"
+)
+
+// Drain stops accepting new connections (ServeWS responds 503) and waits up to
+// timeout for each client's queued messages to be written before closing it
+// with a CloseServiceRestart frame. Clients that haven't drained by the deadline are
+// closed immediately; Drain returns how many were force-closed
+// Unlike Shutdown, Drain leaves the Run loop running
+func (h *Hub) Drain(timeout time.Duration) int {
+	h.draining.Store(true)
+	return h.drainClients(timeout, websocket.CloseServiceRestart, drainReason)
+}
+
+// drainClients closes each client once its send buffer is empty, force-closing
+// whatever is left when the timeout expires
+func (h *Hub) drainClients(timeout time.Duration, code int, reason string) int {
+	deadline := time.Now().Add(timeout)
+	pending := h.snapshot()
+
+	for len(pending) > 0 {
+		remaining := pending[:0]
+		for _, client := range pending {
+			if len(client.send) == 0 {
+				h.closeClient(client, code, reason)
+			} else {
+				remaining = append(remaining, client)
+			}
+		}
+		pending = remaining
+
+		if len(pending) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	for _, client := range pending {
+		h.closeClient(client, code, reason)
+		client.conn.Close()
+		client.log.Warn("WebSocket client did not drain in time, forcing close", "queued", len(client.send))
+	}
+	return len(pending)
+}
+
+// rejectIfDraining responds 503 to new connections while the hub drains or is shut down
+func (h *Hub) rejectIfDraining(w http.ResponseWriter) bool {
+	switch {
+	case h.isDone():
+		http.Error(w, "WebSocket server shutting down", http.StatusServiceUnavailable)
+	case h.draining.Load():
+		http.Error(w, "WebSocket server draining", http.StatusServiceUnavailable)
+	default:
+		return false
+	}
+	return true
+}
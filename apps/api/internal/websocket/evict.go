@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons reported to the OnClientEvicted callback
+const (
+	// EvictFullBuffer: the client's send buffer was full and no SlowClientTimeout is set
+	EvictFullBuffer = "full_buffer"
+
+	// EvictSlowClient: the send buffer stayed saturated longer than SlowClientTimeout
+	EvictSlowClient = "slow_client_timeout"
+
+	// EvictWriteError: writing to the connection failed for another reason
+	EvictWriteError = "write_error"
+
+	// EvictWriteTimeout: a write did not finish within WriteWait
+	EvictWriteTimeout = "write_timeout"
+
+	// EvictConnectionClosed: the connection was closed or reset under the write
+	EvictConnectionClosed = "connection_closed"
+
+	// EvictKicked: the client was disconnected with Kick
+	EvictKicked = "kicked"
+
+	// EvictMessageTooBig: the client sent a message over Config.MaxMessageSize
+	EvictMessageTooBig = "message_too_big"
+
+	// EvictHelloTimeout: the client didn't say hello within Config.HelloTimeout
+	EvictHelloTimeout = "hello_timeout"
+
+	// EvictRateLimited: the client kept exceeding Config.InboundRateLimit
+	EvictRateLimited = "rate_limited"
+
+	// EvictReplaced: the same user reconnected with the client's ID
+	EvictReplaced = "replaced"
+)
+
+// OnClientEvicted registers a callback invoked when the hub forcibly
+// disconnects a client, with one of the Evict* reasons. It runs on the
+// goroutine that evicted the client, so it should be quick
+// Must be called before the hub starts serving connections
+func (h *Hub) OnClientEvicted(fn func(c *Client, reason string)) {
+	h.onClientEvicted = fn
+}
+
+// evict closes client for the given Evict* reason, counting the eviction
+// Returns false if the client was already gone
+func (h *Hub) evict(client *Client, reason string, code int, closeReason string) bool {
+	if !h.closeClient(client, code, closeReason) {
+		return false
+	}
+
+	switch reason {
+	case EvictFullBuffer:
+		h.counters.slowClientsEvicted.Add(1)
+		h.counters.evictedFullBuffer.Add(1)
+	case EvictSlowClient:
+		h.counters.slowClientsEvicted.Add(1)
+	case EvictWriteError:
+		h.counters.evictedWriteError.Add(1)
+		h.counters.writeErrorsOther.Add(1)
+	case EvictWriteTimeout:
+		h.counters.evictedWriteError.Add(1)
+		h.counters.writeErrorsTimeout.Add(1)
+	case EvictConnectionClosed:
+		h.counters.evictedWriteError.Add(1)
+		h.counters.writeErrorsClosed.Add(1)
+	case EvictKicked:
+		h.counters.kicked.Add(1)
+	case EvictMessageTooBig:
+		h.counters.evictedMessageTooBig.Add(1)
+	case EvictRateLimited:
+		h.counters.evictedRateLimited.Add(1)
+	case EvictReplaced:
+		h.counters.replaced.Add(1)
+	}
+
+	if h.onClientEvicted != nil {
+		h.onClientEvicted(client, reason)
+	}
+	return true
+}
+
+// writeFailed evicts the client after a failed write, unless the failure
+// only means a close frame was already sent (e.g. by Kick)
+func (c *Client) writeFailed(err error) {
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return
+	}
+	if errors.Is(err, errDeadline) {
+		c.deadlineFailed(err)
+		return
+	}
+	reason := writeErrorReason(err)
+	if c.hub.evict(c, reason, 0, "") {
+		c.log.Warn("WebSocket write failed, disconnecting client", "reason", reason, "error", err)
+	}
+}
+
+// writeErrorReason classifies a write error as EvictWriteTimeout,
+// EvictConnectionClosed or EvictWriteError
+func writeErrorReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return EvictWriteTimeout
+	}
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return EvictConnectionClosed
+	}
+	return EvictWriteError
+}
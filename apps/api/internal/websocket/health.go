@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// healthResponse is the body written by HealthHandler
+// Orchestrator probes are configured against these keys, so queueDepth
+// keeps its camelCase rather than the snake_case used elsewhere
+type healthResponse struct {
+	Clients    int  `json:"clients"`
+	QueueDepth int  `json:"queueDepth"`
+	Healthy    bool `json:"healthy"`
+}
+
+// nearCapacity reports whether the broadcast queue is at or above
+// Config.BroadcastHighWater percent of its capacity, tracking since when
+func (h *Hub) nearCapacity() bool {
+	depth, capacity := len(h.broadcast), cap(h.broadcast)
+	if depth*100 < capacity*h.config.BroadcastHighWater {
+		h.saturatedSince.Store(0)
+		return false
+	}
+	h.saturatedSince.CompareAndSwap(0, time.Now().UnixNano())
+	return true
+}
+
+// Healthy reports whether the hub is running, not draining, and its broadcast
+// queue hasn't stayed above Config.BroadcastHighWater for longer than
+// Config.HealthSaturationTimeout
+func (h *Hub) Healthy() bool {
+	if h.isDone() || h.draining.Load() {
+		return false
+	}
+	if !h.nearCapacity() {
+		return true
+	}
+	since := h.saturatedSince.Load()
+	return since == 0 || time.Since(time.Unix(0, since)) < h.config.HealthSaturationTimeout
+}
+
+// HealthHandler is an http.HandlerFunc for readiness probes, reporting
+// whether the hub should receive new connections (see Healthy)
+// It responds 200 when healthy and 503 otherwise, with the client count and
+// broadcast queue depth in a JSON body
+func (h *Hub) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{
+		Clients:    h.GetClientCount(),
+		QueueDepth: h.BroadcastQueueDepth(),
+		Healthy:    h.Healthy(),
+	}
+
+	status := http.StatusOK
+	if !resp.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,35 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+func TestHealthHandlerBody(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	dial(t, srv, "")
+
+	rec := httptest.NewRecorder()
+	hub.HealthHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	want := map[string]any{"clients": 1.0, "queueDepth": 0.0, "healthy": true}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+	if len(body) != len(want) {
+		t.Errorf("body = %v, want only %v", body, want)
+	}
+}
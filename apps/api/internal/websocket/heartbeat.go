@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// heartbeatMessageType is the type of the hub's application-level heartbeat
+const heartbeatMessageType = "heartbeat"
+
+// Heartbeat is the payload of a heartbeat message
+type Heartbeat struct {
+	// Unix milliseconds when the heartbeat was sent
+	Timestamp int64 `json:"ts"`
+}
+
+// runHeartbeat broadcasts a heartbeat every Config.HeartbeatInterval until
+// the hub shuts down
+// Heartbeats are local: relayed over a backplane, a client would hear one
+// from every instance, and those would hide a dead link to its own server
+func (h *Hub) runHeartbeat() {
+	ticker := time.NewTicker(h.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case now := <-ticker.C:
+			beat := Heartbeat{Timestamp: now.UnixMilli()}
+			if h.config.BatchHeartbeats {
+				h.addToBatch(heartbeatMessageType, beat, true)
+			} else {
+				h.sendHeartbeat(beat)
+			}
+		}
+	}
+}
+
+// sendHeartbeat broadcasts a heartbeat to this instance's clients
+func (h *Hub) sendHeartbeat(beat Heartbeat) {
+	message := Message{
+		Type: heartbeatMessageType,
+		Data: beat,
+	}
+
+	ok, err := h.publish(context.Background(), message, broadcastRequest{local: true})
+	if err != nil {
+		h.logger.Error("Error marshaling WebSocket message", "type", heartbeatMessageType, "error", err)
+		return
+	}
+	if !ok {
+		h.logger.Warn("WebSocket broadcast channel full, dropping heartbeat")
+	}
+}
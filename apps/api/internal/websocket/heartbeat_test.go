@@ -0,0 +1,65 @@
+package websocket_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// countingBackplane counts what is published to it and never delivers anything
+type countingBackplane struct {
+	published atomic.Int64
+}
+
+func (b *countingBackplane) Publish(ctx context.Context, payload []byte) error {
+	b.published.Add(1)
+	return nil
+}
+
+func (b *countingBackplane) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHeartbeatsStayLocal(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		name := "direct"
+		wantType := "heartbeat"
+		if batched {
+			name, wantType = "batched", "batch"
+		}
+		t.Run(name, func(t *testing.T) {
+			backplane := &countingBackplane{}
+			hub, srv := startHub(t, ws.Config{
+				EnableHeartbeat:   true,
+				HeartbeatInterval: 10 * time.Millisecond,
+				BatchHeartbeats:   batched,
+				Backplane:         backplane,
+				ReplayBuffer:      16,
+			})
+			client := dial(t, srv, "")
+
+			for range 3 {
+				msg, err := client.Next(time.Second)
+				if err != nil || msg.Type != wantType {
+					t.Fatalf("Next = %+v, %v; want a %s", msg, err, wantType)
+				}
+				if msg.Seq != 0 {
+					t.Fatalf("heartbeat has seq %d, want none", msg.Seq)
+				}
+			}
+			if n := backplane.published.Load(); n != 0 {
+				t.Fatalf("%d heartbeats published to the backplane, want 0", n)
+			}
+
+			// Ordinary broadcasts are still relayed
+			if err := hub.BroadcastMessage("event", nil); err != nil {
+				t.Fatalf("BroadcastMessage: %v", err)
+			}
+			waitFor(t, "the broadcast to be relayed", func() bool { return backplane.published.Load() == 1 })
+		})
+	}
+}
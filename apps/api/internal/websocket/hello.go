@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// helloMessageType is sent by a client once it is ready for messages
+	helloMessageType = "hello"
+
+	// Reason sent in the close frame when a client doesn't say hello in time
+	helloTimeoutReason = "hello timeout"
+)
+
+// helloData is the optional payload of a hello message
+type helloData struct {
+	// Version is the protocol version, as in a capabilities message
+	Version int `json:"version"`
+
+	// Channels are channels to subscribe to, as with subscribe messages
+	Channels []string `json:"channels"`
+}
+
+// Ready reports whether the client receives messages, which with
+// Config.RequireHello is only once it has sent its hello
+func (c *Client) Ready() bool {
+	return !c.awaitingHello.Load()
+}
+
+// expectHello starts the Config.HelloTimeout countdown for a client that
+// must say hello; called once the client is registered
+func (c *Client) expectHello() {
+	if !c.awaitingHello.Load() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Already disconnected: closeClient has nothing to stop yet
+	if c.closed {
+		return
+	}
+	c.helloTimer = time.AfterFunc(c.hub.config.HelloTimeout, func() {
+		if c.awaitingHello.Load() && c.hub.evict(c, EvictHelloTimeout, websocket.ClosePolicyViolation, helloTimeoutReason) {
+			c.log.Warn("WebSocket client did not say hello in time, disconnecting", "timeout", c.hub.config.HelloTimeout)
+		}
+	})
+}
+
+// stopHelloTimer cancels the hello countdown, if one is running
+func (c *Client) stopHelloTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.helloTimer != nil {
+		c.helloTimer.Stop()
+		c.helloTimer = nil
+	}
+}
+
+// requestHello handles a hello message
+// {"type":"hello","data":{"version":2,"channels":["logs"]}}, applying its
+// capabilities and subscriptions before marking the client ready
+// Returns false if the message is not a hello
+func (c *Client) requestHello(msg Message) bool {
+	if msg.Type != helloMessageType {
+		return false
+	}
+
+	var data helloData
+	if raw, _ := msg.Data.(json.RawMessage); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &data); err != nil || data.Version < 0 {
+			c.log.Warn("WebSocket client sent malformed hello", "error", err)
+			data = helloData{}
+		}
+	}
+	if data.Version > 0 {
+		c.version.Store(int64(data.Version))
+	}
+	for _, name := range data.Channels {
+		if ch, ok := c.hub.channel(name); ok {
+			ch.Subscribe(c)
+		} else {
+			c.log.Warn("WebSocket client subscribed to unknown channel", "channel", name)
+		}
+	}
+
+	if !c.awaitingHello.Load() {
+		return true
+	}
+	c.stopHelloTimer()
+	// The hub loop marks the client ready so that starts between two
+	// fan-outs; the send returns once it has, so a resume right after the
+	// hello is handled after it too
+	select {
+	case c.hub.ready <- c:
+	case <-c.hub.done:
+	}
+	return true
+}
+
+// markReady starts delivery to a client that said hello, releasing any
+// messages held by BroadcastWhenReady; called from the hub loop
+func (h *Hub) markReady(c *Client) {
+	if current, ok := h.lookup(c.id); !ok || current != c {
+		return
+	}
+	if !c.awaitingHello.Swap(false) {
+		return
+	}
+	h.joined(c)
+	h.releaseHeld()
+}
@@ -0,0 +1,58 @@
+package websocket_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+func TestBroadcastWhenReadyWaitsForHello(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{RequireHello: true})
+	client := dial(t, srv, "ui")
+
+	// The client is connected but not ready, so the message is held
+	if err := hub.BroadcastWhenReady(context.Background(), "early", nil); err != nil {
+		t.Fatalf("BroadcastWhenReady: %v", err)
+	}
+	if n, err := hub.BroadcastMessageN("skipped", nil); err != nil || n != 0 {
+		t.Fatalf("BroadcastMessageN = %d, %v; want it to reach no one before hello", n, err)
+	}
+	if err := client.Send("hello", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg, err := client.Next(time.Second)
+	if err != nil || msg.Type != "early" {
+		t.Fatalf("Next = %+v, %v; want the held message after hello", msg, err)
+	}
+	if n := hub.Stats().HeldMessagesDropped; n != 0 {
+		t.Fatalf("HeldMessagesDropped = %d, want 0", n)
+	}
+}
+
+func TestResumeReplaysBroadcastsSentBeforeHello(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{RequireHello: true, ReplayBuffer: 8})
+	client := dial(t, srv, "ui")
+
+	// Skipped live because the client hasn't said hello yet
+	broadcastN(t, hub, 2)
+
+	if err := client.Send("hello", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := client.Send("resume", map[string]uint64{"last_seq": 0}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := seqs(t, client, 2); !slices.Equal(got, []uint64{1, 2}) {
+		t.Fatalf("replayed seqs = %v, want [1 2]", got)
+	}
+
+	broadcastN(t, hub, 1)
+	if got := seqs(t, client, 1); !slices.Equal(got, []uint64{3}) {
+		t.Fatalf("live seqs = %v, want [3]", got)
+	}
+	expectNoMore(t, client)
+}
@@ -1,374 +1,1684 @@
 package websocket
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrClientNotFound is returned when no connected client matches the given ID
+	ErrClientNotFound = errors.New("websocket: client not found")
+
+	// ErrBroadcastFull is returned when the hub's broadcast channel cannot accept a message
+	ErrBroadcastFull = errors.New("websocket: broadcast channel full")
+
+	// ErrHubClosed is returned when the hub has been shut down
+	ErrHubClosed = errors.New("websocket: hub closed")
 )
 
 const (
-	// Time allowed to write a message to the peer
-	writeWait = 10 * time.Second
+	// Reason sent in the close frame when the hub shuts down
+	shutdownReason = "server shutting down"
+
+	// Reason sent in the close frame when a client can't be registered in time
+	registerTimeoutReason = "server busy"
+
+	// Reason sent in the close frame when a reconnect takes over a client's ID
+	replacedReason = "replaced by a new connection"
+)
+
+// Client represents a single WebSocket connection
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan outbound
+
+	// High-priority lane, drained by writePump before send; never closed
+	sendHigh chan outbound
+
+	// id identifies the connection for targeted delivery
+	id string
+
+	// userID is the authenticated user, if the hub has an Authenticator
+	userID string
+
+	// Connection metadata reported by Hub.Clients
+	remoteAddr  string
+	connectedAt time.Time
+
+	// When the connection is recycled (zero if MaxConnectionAge is unset)
+	expiresAt time.Time
+
+	// ip is the address counted against Config.MaxConnectionsPerIP
+	ip string
+
+	// subprotocol is the negotiated Sec-WebSocket-Protocol, if any
+	subprotocol string
+
+	// compression is set when permessage-deflate was negotiated; wire counts
+	// the bytes written to the network to measure it
+	compression bool
+	wire        *countingConn
+
+	// log carries the client's ID and remote address as structured fields
+	log *slog.Logger
+
+	// Decoded inbound messages awaiting dispatch
+	inbound chan Message
+
+	// Inbound rate limiter (nil when rate limiting is disabled)
+	limiter *rateLimiter
+
+	// Topics this client is subscribed to (guarded by hub.topicsMu)
+	topics map[string]bool
+
+	// Ack timers for messages awaiting acknowledgement, keyed by message ID
+	pendingAcks map[string]*time.Timer
+	ackMu       sync.Mutex
+
+	// Attributes for BroadcastToTag, set at connect time or by the client;
+	// serverTags are the keys set by SetTag, which the client can't change
+	tags       map[string]string
+	serverTags map[string]bool
+	tagsMu     sync.RWMutex
+
+	// Protocol version declared in the client's capabilities message
+	version atomic.Int64
+
+	// Set while the client is backgrounded; see Pause
+	paused atomic.Bool
 
-	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
+	// Set under Config.RequireHello until the client says hello, withholding
+	// messages
+	awaitingHello atomic.Bool
 
-	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = (pongWait * 9) / 10
+	// mu guards closed and helloTimer, and serializes sends against closing
+	// the send channel
+	mu     sync.Mutex
+	closed bool
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 512 * 1024 // 512KB
+	// Disconnects a client that hasn't said hello after Config.HelloTimeout;
+	// stopped on hello or disconnect
+	helloTimer *time.Timer
+
+	// Close frame written by writePump once the send channel is drained
+	closeCode   int
+	closeReason string
+
+	// When the send channel first became saturated (zero if not saturated)
+	fullSince time.Time
+
+	// Messages in the frame being written, reported by OnUndelivered if the
+	// write fails (only accessed by writePump)
+	inflight [][]byte
+
+	// Moving-average ping round-trip time in nanoseconds
+	latency atomic.Int64
+
+	// Time of the last delivered or received message (UnixNano), for IdleTimeout
+	lastActivity atomic.Int64
+
+	// Time of the last pong (UnixNano), zero before the first
+	lastPong atomic.Int64
+
+	// readDone is closed when readPump exits; peerClosed is set if that was
+	// because the client sent a close frame
+	readDone   chan struct{}
+	peerClosed atomic.Bool
+
+	// Number of broadcasts added to the replay buffer when the client
+	// registered, or said hello under Config.RequireHello; later ones were
+	// delivered live (only accessed on the hub loop)
+	joinedAt uint64
+}
+
+// ID returns the client's identifier
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Subprotocol returns the subprotocol negotiated during the handshake,
+// or an empty string if none was agreed
+func (c *Client) Subprotocol() string {
+	return c.subprotocol
+}
+
+// queueResult describes the outcome of queueing a message for a client
+type queueResult int
+
+const (
+	queued queueResult = iota
+	queueFull
+	queueClosed
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		origin := r.Header.Get("Origin")
-		allowedOrigins := []string{
-			"http://localhost:5173",
-			"http://localhost:3000",
-			"http://127.0.0.1:5173",
-			"http://127.0.0.1:3000",
-		}
+// queue attempts a non-blocking send on the client's send channel
+// High-priority messages go to the sendHigh lane, falling back to send when it is full
+// It also tracks how long the channel has been saturated for slow-client eviction
+func (c *Client) queue(message outbound) queueResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		// Allow requests with no origin (e.g., mobile apps, Postman)
-		if origin == "" {
-			return true
+	if c.closed {
+		return queueClosed
+	}
+
+	if message.priority == PriorityHigh {
+		select {
+		case c.sendHigh <- message:
+			c.hub.countQueued(message)
+			return queued
+		default:
 		}
+	}
 
-		for _, allowed := range allowedOrigins {
-			if origin == allowed {
-				log.Printf("WebSocket origin allowed: %s", origin)
-				return true
-			}
+	select {
+	case c.send <- message:
+		c.hub.countQueued(message)
+		// Only clear saturation once the client has worked its way below near-full
+		if len(c.send) < cap(c.send)*9/10 {
+			c.fullSince = time.Time{}
 		}
+		return queued
+	default:
+		if c.fullSince.IsZero() {
+			c.fullSince = time.Now()
+		}
+		return queueFull
+	}
+}
 
-		log.Printf("WebSocket origin rejected: %s", origin)
-		return false
-	},
+// saturatedFor reports how long the client's send channel has been full or near-full
+func (c *Client) saturatedFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fullSince.IsZero() {
+		return 0
+	}
+	return time.Since(c.fullSince)
 }
 
-// Client represents a single WebSocket connection
-type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
-	mu   sync.Mutex
+// closeSend closes the client's send channel exactly once
+// The code and reason are sent in the close frame after queued messages drain;
+// a zero code sends an empty close frame
+func (c *Client) closeSend(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.send)
+	}
+}
+
+// closeMessage returns the payload of the close frame for this client
+func (c *Client) closeMessage() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeCode == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
 }
 
 // Hub maintains the set of active clients and broadcasts messages to clients
 type Hub struct {
-	// Registered clients
-	clients map[*Client]bool
+	// Last assigned broadcast sequence number, updated with atomic.AddUint64
+	// Kept first so it is 64-bit aligned on 32-bit platforms
+	seq uint64
+
+	// Registered clients, sharded by ID (see shard.go)
+	shards      []*clientShard
+	clientCount atomic.Int64
 
-	// Inbound messages from clients
-	broadcast chan []byte
+	// Outbound messages to fan out to every client
+	broadcast chan broadcastRequest
 
 	// Register requests from clients
 	register chan *Client
 
+	// Clients that said hello under Config.RequireHello, to be marked ready
+	ready chan *Client
+
 	// Unregister requests from clients
 	unregister chan *Client
 
-	// Batch buffer for high-frequency events
-	batchBuffer []Message
-	batchTimer  *time.Timer
-	batchMutex  sync.Mutex
+	// Topic subscriptions for scoped broadcasts, as a tree of pattern segments
+	topics   *topicNode
+	topicsMu sync.RWMutex
+
+	// Compiled allowed-origin rules, consulted by the upgrader and swapped
+	// by SetAllowedOrigins
+	originRules atomic.Pointer[[]originRule]
+
+	// Per-hub upgrader so origin checks follow the hub's configuration
+	upgrader websocket.Upgrader
+
+	// Settings applied to each connection
+	config Config
+
+	// Destination for hub log records
+	logger *slog.Logger
+
+	// Traces broadcasts; a no-op unless Config.TracerProvider is set
+	tracer trace.Tracer
+
+	// Handlers for messages sent by clients, keyed by message type; onMessage
+	// receives types without a handler of their own
+	handlers  map[string]InboundHandler
+	onMessage MessageHandler
+
+	// Handlers for client rpc requests, keyed by method
+	rpcHandlers map[string]RPCHandler
+
+	// Outgoing payload validators, keyed by message type
+	validators map[string]Validator
+
+	// Middleware wrapping inbound dispatch, composed into route on first use
+	middleware []Middleware
+	routeOnce  sync.Once
+	route      MessageHandler
+
+	// Lifecycle callbacks, invoked on the hub goroutine
+	onConnect    func(c *Client)
+	onDisconnect func(c *Client)
+
+	// Observes clients the hub disconnects on its own (see Evict* reasons)
+	onClientEvicted func(c *Client, reason string)
+
+	// Receives messages still queued when a client's writePump exits
+	onUndelivered func(c *Client, msgs [][]byte)
+
+	// Acknowledgement callbacks for BroadcastMessageWithAck
+	onAck        AckHandler
+	onAckTimeout AckHandler
 
-	mu sync.RWMutex
+	// Observes each batch flush (message count and reason)
+	onBatchFlush func(count int, reason string)
+
+	// done is closed when the hub shuts down; stopped is closed when Run exits
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	running  atomic.Bool
+
+	// Set by Drain to refuse new connections
+	draining atomic.Bool
+
+	// Tracks client pump goroutines so Shutdown can wait for them
+	pumps sync.WaitGroup
+
+	// Activity counters reported by Stats
+	counters hubCounters
+
+	// How long writePumps wait for clients to answer their close frame
+	// (nanoseconds), set by ShutdownGraceful
+	closeGrace atomic.Int64
+
+	// When the broadcast queue high-water warning was last logged (UnixNano)
+	lastHighWaterWarn atomic.Int64
+
+	// Set from a dropped broadcast until the channel drains below
+	// Config.BroadcastLowWater, for OnBackpressure
+	backpressured  atomic.Bool
+	onBackpressure func(full bool)
+
+	// When the broadcast queue last rose above the high-water mark (UnixNano,
+	// zero while below it), for Healthy
+	saturatedSince atomic.Int64
+
+	// Connection slots held by clients being upgraded or registered
+	slots atomic.Int64
+
+	// Logical channels multiplexed over the hub's connections
+	channels   map[string]*Channel
+	channelsMu sync.RWMutex
+
+	// Registered clients of each authenticated user, for SendToUser
+	users   map[string]map[*Client]bool
+	usersMu sync.RWMutex
+
+	// Open connections per client IP, for MaxConnectionsPerIP
+	ipConns map[string]int
+	ipMu    sync.Mutex
+
+	// Deflate writers for estimating compressed batch sizes
+	flateWriters sync.Pool
+
+	// Broadcast counts per event type (*atomic.Uint64), for EventTypeCounts
+	eventTypes sync.Map
+
+	// Pending batches for high-frequency events, keyed by event type
+	batches    map[string]*typeBatch
+	batchMutex sync.Mutex
+
+	// Messages from BroadcastWhenReady waiting for a first client
+	held   []heldMessage
+	heldMu sync.Mutex
+
+	// Identifies this hub on the backplane; relayQueue holds broadcasts
+	// waiting to be published there
+	instanceID string
+	relayQueue chan outbound
+
+	// Connection lifecycle events waiting for Config.AuditSink (nil without
+	// one); auditStop is closed at the end of shutdown
+	auditQueue chan AuditEvent
+	auditStop  chan struct{}
+	auditOnce  sync.Once
+
+	// Recent broadcasts for resuming clients (nil when replay is disabled)
+	replay *replayBuffer
+	resume chan resumeRequest
+
+	// Held while replay is enabled so broadcasts queued without waiting keep
+	// sequence order; ones that wait for room under BlockOnFull (or in
+	// BroadcastMessageCtx) may still be fanned out after later ones
+	seqMu sync.Mutex
+}
+
+// outbound is an encoded message queued for a client, with its frame type
+type outbound struct {
+	data []byte
+
+	// messageType is websocket.TextMessage or websocket.BinaryMessage
+	messageType int
+
+	// priority selects the client lane the message is queued on
+	priority Priority
+
+	// stream, when set, is written by writePump in place of data (see SendStream)
+	stream *outboundStream
+
+	// noCompress skips compression even when the message is large enough
+	noCompress bool
+
+	// expiresAt, when set, is when the message goes stale; writePump skips
+	// it instead of writing it after that
+	expiresAt time.Time
+}
+
+// expired reports whether the message is past its expiry
+func (o outbound) expired() bool {
+	return !o.expiresAt.IsZero() && time.Now().After(o.expiresAt)
+}
+
+// textMessage wraps an encoded payload for delivery as a text frame
+func textMessage(data []byte) outbound {
+	return outbound{data: data, messageType: websocket.TextMessage}
+}
+
+// broadcastRequest is a message queued for delivery to every client
+type broadcastRequest struct {
+	message outbound
+
+	// reached receives the number of clients the message was queued to (optional)
+	reached chan int
+
+	// seq is the message's sequence number (zero for raw and binary broadcasts)
+	seq uint64
+
+	// span is the enqueue span the fan-out is traced under (invalid if untraced)
+	span trace.SpanContext
+
+	// exclude is skipped during fan-out, e.g. the sender of the message (optional)
+	exclude *Client
+
+	// ackID, when set, is the message ID each reached client must acknowledge
+	ackID string
+
+	// priority is the client lane the message is delivered on
+	priority Priority
+
+	// noCompress sends the message uncompressed
+	noCompress bool
+
+	// ttl, when set, is how long the message stays worth delivering
+	ttl time.Duration
+
+	// neverBlock drops the message when the channel is full even under
+	// BlockOnFull, for broadcasts made on the hub goroutine itself
+	neverBlock bool
+
+	// local messages are only for this instance's clients: they aren't
+	// relayed over the backplane or numbered for replay
+	local bool
 }
 
 // Message represents a WebSocket message
 type Message struct {
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
+
+	// ID identifies messages that clients must acknowledge (see
+	// BroadcastMessageWithAck), and correlates rpc requests with their results
+	ID string `json:"id,omitempty"`
+
+	// BatchType names the event type contained in a "batch" message
+	BatchType string `json:"batch_type,omitempty"`
+
+	// Seq numbers broadcasts in the order they were sent; a gap means messages
+	// were dropped and the client may want to resync. Unset on targeted and
+	// topic messages
+	Seq uint64 `json:"seq,omitempty"`
+
+	// Trace carries W3C trace context (traceparent, tracestate) when tracing is enabled
+	Trace map[string]string `json:"trace,omitempty"`
+
+	// Channel names the logical channel a multiplexed message belongs to
+	Channel string `json:"channel,omitempty"`
+
+	// Method is the method an rpc request calls (inbound only; see HandleRPC)
+	Method string `json:"method,omitempty"`
 }
 
-const (
-	// Batch window for high-frequency events (50ms)
-	batchWindow = 50 * time.Millisecond
-	// Maximum batch size before flushing
-	maxBatchSize = 10
-)
+// NewHub creates a new WebSocket hub using DefaultConfig
+func NewHub() *Hub {
+	return newHub(DefaultConfig().withDefaults())
+}
+
+// NewHubWithConfig creates a new WebSocket hub with the given configuration
+// Zero-valued fields take their defaults; an error is returned if the
+// resulting settings are out of range or inconsistent, e.g. a ping period
+// not below the pong wait or an allowed origin that doesn't compile
+func NewHubWithConfig(cfg Config) (*Hub, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return newHub(cfg), nil
+}
 
-// NewHub creates a new WebSocket hub
+// newHub builds a hub from a defaulted, validated configuration
 // The broadcast channel is buffered to prevent blocking during high-frequency events
-// Buffer size of 256 is a reasonable default (can be tuned based on load)
-func NewHub() *Hub {
-	return &Hub{
-		clients:     make(map[*Client]bool),
-		broadcast:   make(chan []byte, 256), // Buffered channel to prevent blocking
+// (see Config.BroadcastBuffer; the default of 256 can be tuned based on load)
+func newHub(cfg Config) *Hub {
+	h := &Hub{
+		shards:      newClientShards(clientShards),
+		topics:      newTopicNode(),
+		handlers:    make(map[string]InboundHandler),
+		rpcHandlers: make(map[string]RPCHandler),
+		validators:  make(map[string]Validator),
+		broadcast:   make(chan broadcastRequest, cfg.BroadcastBuffer), // Buffered channel to prevent blocking
 		register:    make(chan *Client),
+		ready:       make(chan *Client),
 		unregister:  make(chan *Client),
-		batchBuffer: make([]Message, 0, maxBatchSize),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		config:      cfg,
+		logger:      cfg.Logger,
+		tracer:      cfg.TracerProvider.Tracer(tracerName),
+		batches:     make(map[string]*typeBatch),
+		ipConns:     make(map[string]int),
+		users:       make(map[string]map[*Client]bool),
+		channels:    make(map[string]*Channel),
+		instanceID:  uuid.NewString(),
+		replay:      newReplayBuffer(cfg.ReplayBuffer),
+		resume:      make(chan resumeRequest),
+	}
+	rules := compileOriginRules(cfg.AllowedOrigins, cfg.Logger)
+	h.originRules.Store(&rules)
+	if cfg.Backplane != nil {
+		h.relayQueue = make(chan outbound, backplaneBuffer)
+	}
+	if cfg.AuditSink != nil {
+		h.auditQueue = make(chan AuditEvent, auditBuffer)
+		h.auditStop = make(chan struct{})
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		CheckOrigin:       h.checkOrigin,
+		EnableCompression: !cfg.DisableCompression,
+		Subprotocols:      cfg.Subprotocols,
 	}
+	if cfg.ShareWriteBuffers {
+		h.upgrader.WriteBufferPool = &sync.Pool{}
+	}
+	return h
 }
 
 // Run starts the hub's main loop
-// This should be run in a separate goroutine
+// This should be run in a separate goroutine; it returns after Shutdown
 func (h *Hub) Run() {
+	h.RunContext(context.Background())
+}
+
+// RunContext runs the hub's main loop until ctx is canceled or Shutdown is called
+// When ctx is canceled the hub shuts down, closing every client before returning
+// It must only be called once per hub
+func (h *Hub) RunContext(ctx context.Context) {
+	h.running.Store(true)
+	if h.config.Backplane != nil {
+		h.runBackplane()
+	}
+	if h.config.AuditSink != nil {
+		h.runAudit()
+	}
+	if h.config.EnableHeartbeat {
+		go h.runHeartbeat()
+	}
+	h.loop(ctx)
+	close(h.stopped)
+
+	if ctx.Err() != nil {
+		h.Shutdown()
+	}
+}
+
+// loop processes registrations and broadcasts until ctx or the hub is done
+func (h *Hub) loop(ctx context.Context) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
+		case <-h.done:
+			return
+
 		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("WebSocket client connected. Total clients: %d", len(h.clients))
+			total := h.addClient(client)
+			if client.Ready() {
+				h.joined(client)
+			}
+			client.log.Info("WebSocket client connected", "total_clients", total)
+			h.audit(AuditEvent{Event: AuditConnect, ClientID: client.id, RemoteAddr: client.remoteAddr})
+			if h.onConnect != nil {
+				h.onConnect(client)
+			}
+			h.announceConnection(client, PresenceJoin, total)
+			if client.Ready() {
+				h.releaseHeld()
+			}
+
+		case client := <-h.ready:
+			h.markReady(client)
 
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			h.removeClient(client)
+
+		case req := <-h.broadcast:
+			h.fanOut(req)
+			h.checkRecovered()
+
+		case req := <-h.resume:
+			h.replayTo(req)
+		}
+	}
+}
+
+// isDone reports whether the hub has been shut down
+func (h *Hub) isDone() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// fanOut delivers a broadcast request to every registered client
+func (h *Hub) fanOut(req broadcastRequest) {
+	if req.seq != 0 && h.replay != nil {
+		h.replay.add(req.seq, req.message)
+	}
+
+	span := h.startFanOutSpan(req)
+
+	// Send to all clients without holding the lock
+	reached := 0
+	for _, client := range h.snapshot() {
+		if client == req.exclude {
+			continue
+		}
+		if h.broadcastTo(client, req.message) {
+			reached++
+			if req.ackID != "" {
+				client.expectAck(req.ackID)
 			}
-			h.mu.Unlock()
-			log.Printf("WebSocket client disconnected. Total clients: %d", len(h.clients))
-
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			// Create a snapshot of clients to avoid holding lock during send
-			clients := make([]*Client, 0, len(h.clients))
-			for client := range h.clients {
-				clients = append(clients, client)
+		} else if span != nil {
+			spanDropped(span, "client queue full", attribute.String("websocket.client_id", client.id))
+		}
+	}
+	if span != nil {
+		span.SetAttributes(attribute.Int("websocket.clients_reached", reached))
+		span.End()
+	}
+	if req.reached != nil {
+		req.reached <- reached
+	}
+}
+
+// drainBroadcasts delivers every request still waiting in the broadcast channel
+func (h *Hub) drainBroadcasts() {
+	for {
+		select {
+		case req := <-h.broadcast:
+			h.fanOut(req)
+			h.checkRecovered()
+		default:
+			return
+		}
+	}
+}
+
+// snapshot returns the currently registered clients
+// Taking a copy avoids holding the locks while sending; shards are locked
+// one at a time, so registrations elsewhere aren't held up
+func (h *Hub) snapshot() []*Client {
+	clients := make([]*Client, 0, h.clientCount.Load())
+	for _, shard := range h.shards {
+		shard.mu.RLock()
+		for client := range shard.clients {
+			clients = append(clients, client)
+		}
+		shard.mu.RUnlock()
+	}
+	return clients
+}
+
+// deliver queues a message for a single client
+// If the client's send channel is full, the message is dropped; the client is
+// disconnected once it has stayed saturated longer than Config.SlowClientTimeout
+// (immediately when no timeout is configured)
+// Messages to a client that hasn't said its hello yet (see
+// Config.RequireHello) are skipped; broadcasts go through broadcastTo, which
+// also skips paused clients
+func (h *Hub) deliver(client *Client, message outbound) bool {
+	if !client.Ready() {
+		return false
+	}
+	switch client.queue(message) {
+	case queued:
+		return true
+	case queueFull:
+		if client.saturatedFor() >= h.config.SlowClientTimeout {
+			reason := EvictSlowClient
+			if h.config.SlowClientTimeout == 0 {
+				reason = EvictFullBuffer
 			}
-			h.mu.RUnlock()
-
-			// Send to all clients without holding the lock
-			for _, client := range clients {
-				select {
-				case client.send <- message:
-				default:
-					// Client's send channel is full, disconnect them
-					h.mu.Lock()
-					if _, ok := h.clients[client]; ok {
-						delete(h.clients, client)
-						close(client.send)
-					}
-					h.mu.Unlock()
-				}
+			if h.evict(client, reason, websocket.CloseTryAgainLater, slowClientReason) {
+				client.log.Warn("WebSocket client send buffer full, disconnecting slow client", "reason", reason)
 			}
 		}
 	}
+	return false
+}
+
+// removeClient unregisters a client and closes its send channel
+// Safe to call multiple times and from any goroutine; only the call that
+// actually removes the client fires the disconnect callback
+func (h *Hub) removeClient(client *Client) bool {
+	return h.closeClient(client, 0, "")
+}
+
+// closeClient unregisters a client, closing its send channel so writePump
+// flushes queued messages and then sends a close frame with the given code
+func (h *Hub) closeClient(client *Client, code int, reason string) bool {
+	ok, total := h.dropClient(client)
+
+	topics := h.unsubscribeAll(client)
+	h.leaveChannels(client)
+	client.closeSend(code, reason)
+	client.stopHelloTimer()
+	client.cancelAcks()
+
+	if !ok {
+		return false
+	}
+	client.log.Info("WebSocket client disconnected", "total_clients", total)
+	h.audit(AuditEvent{Event: AuditDisconnect, ClientID: client.id, RemoteAddr: client.remoteAddr, Reason: reason})
+	if h.onDisconnect != nil {
+		h.onDisconnect(client)
+	}
+	if len(topics) > 0 {
+		h.announceTopics(client, PresenceLeave, topics)
+	} else {
+		h.announceConnection(client, PresenceLeave, total)
+	}
+	return true
 }
 
 // Shutdown gracefully shuts down the hub, flushing any pending batches
+// and closing every client connection with a CloseServiceRestart frame
 func (h *Hub) Shutdown() {
-	h.batchMutex.Lock()
+	h.ShutdownWithReason(shutdownReason)
+}
 
-	// Stop timer if running
-	if h.batchTimer != nil {
-		h.batchTimer.Stop()
-		h.batchTimer = nil
-	}
+// ShutdownWithReason shuts down the hub like Shutdown, sending the given
+// reason in each client's close frame
+// It stops the Run loop, drains clients briefly (see Drain) and waits
+// (up to WriteWait) for client goroutines to exit
+func (h *Hub) ShutdownWithReason(reason string) {
+	h.shutdown(reason, 0)
+}
+
+// shutdown stops the hub, giving clients grace to answer their close frames
+// Returns the clients that were connected
+func (h *Hub) shutdown(reason string, grace time.Duration) []*Client {
+	h.closeGrace.Store(int64(grace))
 
 	// Flush any remaining batched messages
-	if len(h.batchBuffer) > 0 {
-		h.flushBatch() // flushBatch maintains the lock
+	h.flushAllBatches(BatchFlushShutdown)
+
+	h.stopOnce.Do(func() { close(h.done) })
+	if h.running.Load() {
+		<-h.stopped
 	}
 
-	h.batchMutex.Unlock()
+	// Deliver anything still queued now that Run is no longer consuming
+	h.drainBroadcasts()
+
+	clients := h.snapshot()
+	h.drainClients(shutdownDrainTimeout, websocket.CloseServiceRestart, reason)
+
+	// Wait for writePumps to send their close frames, then force-close stragglers
+	exited := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(h.config.WriteWait + grace):
+		h.logger.Warn("WebSocket shutdown timed out waiting for clients, forcing close")
+		for _, client := range clients {
+			client.conn.Close()
+		}
+	}
+	h.stopAudit()
+	return clients
 }
 
-// flushBatch sends all batched messages at once
-// Must be called with batchMutex already locked
-// The mutex remains locked after this function returns
-func (h *Hub) flushBatch() {
-	if len(h.batchBuffer) == 0 {
-		return
+// BroadcastMessage sends a message to all connected clients
+// This is a non-blocking operation - if the channel is full, the message is
+// dropped - unless Config.BroadcastMode is BlockOnFull
+// Returns ErrBroadcastFull if the message was dropped, or the encoding error
+// (wrapping ErrInvalidPayload if data failed its type's validator)
+func (h *Hub) BroadcastMessage(eventType string, data interface{}) error {
+	return h.sendBroadcast(Message{Type: eventType, Data: data}, broadcastRequest{})
+}
+
+// BroadcastOptions are per-broadcast settings for BroadcastWithOptions and
+// BroadcastBinary; the zero value broadcasts like BroadcastMessage
+type BroadcastOptions struct {
+	// Priority is the client lane the message is queued on (see BroadcastPriority)
+	Priority Priority
+
+	// TTL, when set, is how long the message stays worth delivering (see
+	// BroadcastWithTTL)
+	TTL time.Duration
+
+	// NoCompress sends the message uncompressed even when it is large enough
+	// to compress, for payloads that are already compressed (images, gzipped
+	// blobs) or that compress poorly
+	NoCompress bool
+}
+
+// request returns a broadcast request carrying the options
+func (o BroadcastOptions) request() broadcastRequest {
+	return broadcastRequest{priority: o.Priority, ttl: o.TTL, noCompress: o.NoCompress}
+}
+
+// apply sets the options on an already-encoded frame
+func (o BroadcastOptions) apply(frame outbound) outbound {
+	frame.priority = o.Priority
+	frame.noCompress = o.NoCompress
+	if o.TTL > 0 {
+		frame.expiresAt = time.Now().Add(o.TTL)
+	}
+	return frame
+}
+
+// BroadcastWithOptions sends a message to all connected clients with the
+// given per-broadcast options
+// Otherwise behaves like BroadcastMessage
+func (h *Hub) BroadcastWithOptions(opts BroadcastOptions, eventType string, data interface{}) error {
+	return h.sendBroadcast(Message{Type: eventType, Data: data}, opts.request())
+}
+
+// sendBroadcast publishes message with req's options, logging any failure
+// Returns ErrBroadcastFull if the message was dropped, or the encoding error
+func (h *Hub) sendBroadcast(message Message, req broadcastRequest) error {
+	ok, err := h.publish(context.Background(), message, req)
+	if err != nil {
+		h.logger.Error("Error marshaling WebSocket message", "type", message.Type, "error", err)
+		return err
 	}
 
-	// Stop and clear timer before flushing
-	if h.batchTimer != nil {
-		h.batchTimer.Stop()
-		h.batchTimer = nil
+	if !ok {
+		h.logger.Warn("WebSocket broadcast channel full, dropping message", "type", message.Type)
+		return ErrBroadcastFull
 	}
+	return nil
+}
+
+// encodeLogged encodes a message sent straight to clients rather than through
+// the broadcast channel, logging a failure with the extra attributes
+func (h *Hub) encodeLogged(message Message, attrs ...any) (outbound, error) {
+	frame, err := h.encode(message)
+	if err != nil {
+		h.logger.Error("Error marshaling WebSocket message",
+			append([]any{"type", message.Type, "error", err}, attrs...)...)
+	}
+	return frame, err
+}
 
-	// Copy buffer to avoid holding lock during channel send
-	buffer := make([]Message, len(h.batchBuffer))
-	copy(buffer, h.batchBuffer)
-	h.batchBuffer = h.batchBuffer[:0]
+// BroadcastExcept sends a message to all connected clients except sender,
+// so a client's own message isn't echoed back to it
+// A nil sender behaves exactly like BroadcastMessage
+func (h *Hub) BroadcastExcept(sender *Client, eventType string, data interface{}) {
+	h.sendBroadcast(Message{Type: eventType, Data: data}, broadcastRequest{exclude: sender})
+}
 
-	// Unlock before potentially blocking channel operation
-	h.batchMutex.Unlock()
+// BroadcastFunc sends a message to every connected client for which predicate
+// returns true and reports how many clients it was queued to
+// The predicate runs on the caller's goroutine against a snapshot of the
+// clients, without any hub lock held, so it may call back into the hub
+func (h *Hub) BroadcastFunc(predicate func(c *Client) bool, eventType string, data interface{}) int {
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data})
+	if err != nil {
+		return 0
+	}
 
-	// Send all batched messages as a single batch
-	batchMessage := Message{
-		Type: "batch",
-		Data: buffer,
+	reached := 0
+	for _, client := range h.snapshot() {
+		if predicate(client) && h.broadcastTo(client, frame) {
+			reached++
+		}
 	}
+	return reached
+}
 
-	jsonData, err := json.Marshal(batchMessage)
+// BroadcastToClients sends a message to each connected client whose ID is in
+// ids and reports how many it was queued to; IDs with no connected client
+// (and repeated IDs) are skipped. The message is encoded only once
+func (h *Hub) BroadcastToClients(ids []string, eventType string, data interface{}) (delivered int) {
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data})
 	if err != nil {
-		log.Printf("Error marshaling batched WebSocket message: %v", err)
-		h.batchMutex.Lock()
-		return
+		return 0
 	}
 
-	select {
-	case h.broadcast <- jsonData:
-		// Success
-	default:
-		log.Printf("WebSocket broadcast channel full, dropping batch")
+	targets := make([]*Client, 0, len(ids))
+	seen := make(map[*Client]bool, len(ids))
+	for _, id := range ids {
+		if client, ok := h.lookup(id); ok && !seen[client] {
+			seen[client] = true
+			targets = append(targets, client)
+		}
 	}
 
-	// Re-lock mutex before returning
-	h.batchMutex.Lock()
+	// Deliver without holding the lock, as deliver may evict a slow client
+	for _, client := range targets {
+		if h.deliver(client, frame) {
+			delivered++
+		}
+	}
+	return delivered
 }
 
-// BroadcastMessage sends a message to all connected clients
-// This is a non-blocking operation - if the channel is full, the message is dropped
-func (h *Hub) BroadcastMessage(eventType string, data interface{}) {
+// BroadcastMessageCtx sends a message to all connected clients, waiting for
+// room in the broadcast channel instead of dropping the message when it is full
+// Returns ctx.Err() if ctx is done first, or ErrHubClosed if the hub shuts down
+// A message that had to wait may be delivered after broadcasts sent later
+func (h *Hub) BroadcastMessageCtx(ctx context.Context, eventType string, data interface{}) error {
 	message := Message{
 		Type: eventType,
 		Data: data,
 	}
 
-	jsonData, err := json.Marshal(message)
+	spanCtx, span := h.startSpan(ctx, "websocket.enqueue", &message)
+	defer span.End()
+
+	req, err := h.prepare(message, broadcastRequest{span: span.SpanContext()})
 	if err != nil {
-		log.Printf("Error marshaling WebSocket message: %v", err)
-		return
+		spanError(span, err)
+		h.logger.Error("Error marshaling WebSocket message", "type", eventType, "error", err)
+		return err
 	}
+	h.relay(req.message)
 
 	select {
-	case h.broadcast <- jsonData:
-	default:
-		log.Printf("WebSocket broadcast channel full, dropping message")
+	case h.broadcast <- req:
+		h.counters.messagesBroadcast.Add(1)
+		h.countEventType(eventType, 1)
+		h.warnIfNearCapacity()
+		return nil
+	case <-ctx.Done():
+		h.counters.messagesDropped.Add(1)
+		spanDropped(span, "context done")
+		spanError(span, spanCtx.Err())
+		return ctx.Err()
+	case <-h.done:
+		spanDropped(span, "hub closed")
+		return ErrHubClosed
+	}
+}
+
+// BroadcastRaw sends an already-encoded JSON message to all connected clients
+// as a text frame, skipping the marshal step when the same payload is sent
+// repeatedly. The data is not copied, so callers must not modify it afterwards
+// Non-blocking with the same drop-on-full semantics as BroadcastMessage
+func (h *Hub) BroadcastRaw(jsonData []byte) {
+	h.broadcastFrame(textMessage(jsonData))
+}
+
+// BroadcastBinary sends raw bytes to all connected clients as a binary frame
+// e.g. MessagePack-encoded payloads, with options if given (e.g. NoCompress
+// for blobs that are already compressed). The data is not copied, so callers
+// must not modify it after the call. Non-blocking: dropped if the channel is full
+func (h *Hub) BroadcastBinary(data []byte, opts ...BroadcastOptions) {
+	frame := outbound{data: data, messageType: websocket.BinaryMessage}
+	for _, o := range opts {
+		frame = o.apply(frame)
 	}
+	h.broadcastFrame(frame)
 }
 
-// BroadcastMessageBatched batches high-frequency events to reduce client load
-// Events are batched for 50ms or until batch size reaches maxBatchSize
-// This is thread-safe and non-blocking
-func (h *Hub) BroadcastMessageBatched(eventType string, data interface{}) {
-	h.batchMutex.Lock()
+// broadcastFrame relays and queues an already-encoded frame, logging a drop
+func (h *Hub) broadcastFrame(frame outbound) {
+	h.relay(frame)
+	if !h.enqueue(broadcastRequest{message: frame}) {
+		h.logger.Warn("WebSocket broadcast channel full, dropping message", "bytes", len(frame.data))
+	}
+}
 
+// BroadcastMessageN sends a message to all connected clients and reports how
+// many clients it was queued to. It waits for the hub loop to fan the message
+// out, and returns ErrBroadcastFull if the broadcast channel is full (without
+// waiting for room unless in BlockOnFull mode)
+func (h *Hub) BroadcastMessageN(eventType string, data interface{}) (int, error) {
 	message := Message{
 		Type: eventType,
 		Data: data,
 	}
 
-	h.batchBuffer = append(h.batchBuffer, message)
+	reached := make(chan int, 1)
+	if err := h.sendBroadcast(message, broadcastRequest{reached: reached}); err != nil {
+		return 0, err
+	}
 
-	// Flush if batch is full
-	if len(h.batchBuffer) >= maxBatchSize {
-		h.flushBatch() // flushBatch maintains the lock
-		h.batchMutex.Unlock()
-		return
+	select {
+	case n := <-reached:
+		return n, nil
+	case <-h.done:
+		return 0, ErrHubClosed
 	}
+}
 
-	// Start timer if this is the first message in the batch
-	if h.batchTimer == nil {
-		h.batchTimer = time.AfterFunc(batchWindow, func() {
-			h.batchMutex.Lock()
-			// Double-check timer is still valid (might have been flushed by size)
-			if h.batchTimer != nil {
-				h.flushBatch() // flushBatch maintains the lock
-			}
-			h.batchMutex.Unlock()
-		})
+// nextSeq returns the next broadcast sequence number
+func (h *Hub) nextSeq() uint64 {
+	return atomic.AddUint64(&h.seq, 1)
+}
+
+// publish encodes message and queues it for fan-out with req's options,
+// traced as a child of ctx
+// Messages without a sequence number are stamped with the next one
+// Returns false if the broadcast channel was full
+func (h *Hub) publish(ctx context.Context, message Message, req broadcastRequest) (bool, error) {
+	_, span := h.startSpan(ctx, "websocket.enqueue", &message)
+	defer span.End()
+	req.span = span.SpanContext()
+
+	req, queued, err := h.prepareAndOffer(message, req)
+	if err != nil {
+		spanError(span, err)
+		return false, err
+	}
+
+	if !queued && !h.enqueueFull(req) {
+		spanDropped(span, "broadcast channel full")
+		return false, nil
+	}
+	// Batches are counted by the types of their events when flushed
+	if message.Type != batchMessageType {
+		h.countEventType(message.Type, 1)
+	}
+	return true, nil
+}
+
+// prepareAndOffer prepares req, relays it and offers it to the broadcast
+// channel without blocking
+// While replay is enabled this holds seqMu, so messages that find room are
+// queued in sequence order. The lock is never held while waiting for room:
+// the hub loop publishes too (presence, held messages) and would deadlock
+// behind a producer blocked under BlockOnFull
+func (h *Hub) prepareAndOffer(message Message, req broadcastRequest) (broadcastRequest, bool, error) {
+	if h.replay != nil {
+		h.seqMu.Lock()
+		defer h.seqMu.Unlock()
+	}
+
+	req, err := h.prepare(message, req)
+	if err != nil {
+		return req, false, err
+	}
+	if !req.local {
+		h.relay(req.message)
 	}
+	return req, h.offer(req), nil
+}
+
+// prepare stamps message with the next sequence number if it has none and
+// encodes it into req
+func (h *Hub) prepare(message Message, req broadcastRequest) (broadcastRequest, error) {
+	if message.Seq == 0 && !req.local {
+		message.Seq = h.nextSeq()
+	}
+	req.seq = message.Seq
+
+	frame, err := h.encode(message)
+	if err != nil {
+		return req, err
+	}
+	opts := BroadcastOptions{Priority: req.priority, TTL: req.ttl, NoCompress: req.noCompress}
+	req.message = opts.apply(frame)
+	return req, nil
+}
+
+// enqueue sends req on the broadcast channel without blocking, or under
+// BlockOnFull waits for room for up to Config.BlockTimeout
+// Returns false (counting the drop) if the message could not be queued
+func (h *Hub) enqueue(req broadcastRequest) bool {
+	return h.offer(req) || h.enqueueFull(req)
+}
+
+// offer sends req on the broadcast channel if it has room
+func (h *Hub) offer(req broadcastRequest) bool {
+	select {
+	case h.broadcast <- req:
+		h.counters.messagesBroadcast.Add(1)
+		h.warnIfNearCapacity()
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueFull handles a request the broadcast channel had no room for:
+// under BlockOnFull it waits for room, otherwise it drops and counts it
+func (h *Hub) enqueueFull(req broadcastRequest) bool {
+	if h.config.BroadcastMode == BlockOnFull && !req.neverBlock && h.waitEnqueue(req) {
+		h.counters.messagesBroadcast.Add(1)
+		return true
+	}
+	h.counters.messagesDropped.Add(1)
+	h.overflowed()
+	return false
+}
+
+// waitEnqueue blocks until req is queued, Config.BlockTimeout passes (if set)
+// or the hub shuts down
+func (h *Hub) waitEnqueue(req broadcastRequest) bool {
+	var timeout <-chan time.Time
+	if h.config.BlockTimeout > 0 {
+		timer := time.NewTimer(h.config.BlockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	h.warnIfNearCapacity()
+	select {
+	case h.broadcast <- req:
+		return true
+	case <-timeout:
+		h.counters.blockTimeouts.Add(1)
+		return false
+	case <-h.done:
+		return false
+	}
+}
+
+// OnConnect registers a callback invoked after a client is registered
+// Callbacks run on the hub's Run goroutine and block further hub processing,
+// so they should be quick or dispatch work to their own goroutine
+// Must be called before Run is started
+func (h *Hub) OnConnect(fn func(c *Client)) {
+	h.onConnect = fn
+}
 
-	h.batchMutex.Unlock()
+// OnDisconnect registers a callback invoked exactly once when a client is removed,
+// whether it disconnected itself or was evicted for a full send buffer
+// Callbacks run on the hub goroutine that removed the client (normally Run),
+// so they should be quick or dispatch work to their own goroutine
+// Must be called before Run is started
+func (h *Hub) OnDisconnect(fn func(c *Client)) {
+	h.onDisconnect = fn
+}
+
+// SendToClient sends a message to the single client with the given ID
+// Returns ErrClientNotFound if no such client is connected
+// If the client's send channel is full, the message is dropped and a slow client disconnected
+func (h *Hub) SendToClient(id string, eventType string, data interface{}) error {
+	client, ok := h.lookup(id)
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data})
+	if err != nil {
+		return err
+	}
+
+	h.deliver(client, frame)
+	return nil
+}
+
+// Kick disconnects the client with the given ID, sending a close frame with
+// the given code and reason ahead of any messages still queued for it
+// (after them when Config.SendCloseNotice is set)
+// A zero code uses ClosePolicyViolation, telling the client not to reconnect
+// Returns ErrClientNotFound if no such client is connected
+func (h *Hub) Kick(id string, code int, reason string) error {
+	if code == 0 {
+		code = websocket.ClosePolicyViolation
+	}
+
+	client, ok := h.lookup(id)
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	// WriteControl may run alongside writePump; once the close frame is sent,
+	// writePump's next write fails and it closes the connection
+	// With close notices enabled writePump sends the notice and close frame
+	// itself, after any queued messages
+	if !h.config.SendCloseNotice {
+		deadline := time.Now().Add(h.config.WriteWait)
+		if err := client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline); err != nil {
+			client.log.Warn("Error writing WebSocket close frame", "code", code, "error", err)
+		}
+	}
+
+	// Audit the kick ahead of the disconnect it causes
+	h.audit(AuditEvent{Event: AuditKick, ClientID: client.id, RemoteAddr: client.remoteAddr, Reason: reason})
+	if !h.evict(client, EvictKicked, code, reason) {
+		return ErrClientNotFound
+	}
+	client.log.Info("WebSocket client kicked", "code", code, "reason", reason)
+	return nil
 }
 
 // GetClientCount returns the number of connected clients
 func (h *Hub) GetClientCount() int {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	return len(h.clients)
+	return int(h.clientCount.Load())
+}
+
+// acquireSlot reserves a connection slot, enforcing MaxClients
+// Uses compare-and-swap so concurrent upgrades can't both pass the limit
+func (h *Hub) acquireSlot() bool {
+	limit := int64(h.config.MaxClients)
+	for {
+		n := h.slots.Load()
+		if limit > 0 && n >= limit {
+			return false
+		}
+		if h.slots.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseSlot frees a slot taken by acquireSlot
+func (h *Hub) releaseSlot() {
+	h.slots.Add(-1)
 }
 
 // ServeWS handles WebSocket requests from clients
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if h.rejectIfDraining(w) {
+		return
+	}
+
+	userID, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkSubprotocol(w, r) {
+		return
+	}
+
+	ip := h.clientIP(r)
+	if !h.acquireIP(ip) {
+		h.logger.Warn("WebSocket per-IP limit reached, rejecting connection",
+			"max_connections_per_ip", h.config.MaxConnectionsPerIP, "ip", ip)
+		http.Error(w, "Too many WebSocket connections from this address", http.StatusTooManyRequests)
+		return
+	}
+
+	// Reserve a slot before upgrading so rejected clients cost nothing
+	if !h.acquireSlot() {
+		h.releaseIP(ip)
+		h.logger.Warn("WebSocket client limit reached, rejecting connection",
+			"max_clients", h.config.MaxClients, "remote_addr", r.RemoteAddr)
+		http.Error(w, "Too many WebSocket connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	// One connection per ID. A reconnect from the same user replaces a stale
+	// connection the hub hasn't noticed is gone; anyone else is refused, so
+	// nobody can take over another user's targeted messages by reusing its ID
+	id := clientIDFromRequest(r)
+	if !h.claimID(id) && !h.replaceClient(id, userID) {
+		h.releaseSlot()
+		h.releaseIP(ip)
+		h.logger.Warn("WebSocket client ID already connected, rejecting connection",
+			"client_id", id, "remote_addr", r.RemoteAddr)
+		http.Error(w, "WebSocket client ID already connected", http.StatusConflict)
+		return
+	}
+
+	counting := &countingResponseWriter{ResponseWriter: w}
+	conn, err := h.upgrader.Upgrade(counting, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		h.releaseID(id)
+		h.releaseSlot()
+		h.releaseIP(ip)
+		h.logger.Error("WebSocket upgrade error", "error", err, "remote_addr", r.RemoteAddr)
 		return
 	}
 
+	remoteAddr := conn.RemoteAddr().String()
 	client := &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:         h,
+		conn:        conn,
+		send:        make(chan outbound, h.config.ClientSendBuffer),
+		sendHigh:    make(chan outbound, h.config.HighPrioritySendBuffer),
+		id:          id,
+		userID:      userID,
+		remoteAddr:  remoteAddr,
+		connectedAt: time.Now(),
+		ip:          ip,
+		subprotocol: conn.Subprotocol(),
+		compression: h.offersCompression(r),
+		wire:        counting.conn,
+		log:         h.logger.With("client_id", id, "remote_addr", remoteAddr),
+		inbound:     make(chan Message, inboundBufferSize),
+		readDone:    make(chan struct{}),
+		limiter:     newRateLimiter(h.config.InboundRateLimit, h.config.InboundBurst),
+		topics:      make(map[string]bool),
+		tags:        tagsFromRequest(r),
+	}
+
+	client.expiresAt = h.connectionDeadline(client.connectedAt)
+	client.awaitingHello.Store(h.config.RequireHello)
+	client.touch()
+
+	if err := conn.SetCompressionLevel(h.config.CompressionLevel); err != nil {
+		client.log.Error("WebSocket compression level error", "error", err)
+	}
+
+	// Count the pumps before registering so Shutdown's Wait observes them
+	h.pumps.Add(3)
+	// Give up rather than hang if the Run loop is stuck or was never started
+	timeout := time.NewTimer(h.config.RegisterTimeout)
+	defer timeout.Stop()
+	abort := func(code int, reason string) {
+		h.pumps.Add(-3)
+		h.releaseID(id)
+		h.releaseSlot()
+		h.releaseIP(ip)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(h.config.WriteWait))
+		conn.Close()
+	}
+	select {
+	case client.hub.register <- client:
+	case <-h.done:
+		abort(websocket.CloseServiceRestart, shutdownReason)
+		return
+	case <-r.Context().Done():
+		abort(websocket.CloseGoingAway, "")
+		return
+	case <-timeout.C:
+		client.log.Error("WebSocket client registration timed out", "timeout", h.config.RegisterTimeout)
+		abort(websocket.CloseTryAgainLater, registerTimeoutReason)
+		return
 	}
 
-	client.hub.register <- client
+	client.expectHello()
 
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump()
+	go client.dispatchPump()
+}
+
+// checkSubprotocol rejects requests that offer none of the configured
+// subprotocols when Config.RequireSubprotocol is set
+func (h *Hub) checkSubprotocol(w http.ResponseWriter, r *http.Request) bool {
+	if !h.config.RequireSubprotocol {
+		return true
+	}
+
+	for _, offered := range websocket.Subprotocols(r) {
+		if slices.Contains(h.config.Subprotocols, offered) {
+			return true
+		}
+	}
+
+	h.logger.Warn("WebSocket client offered no supported subprotocol",
+		"offered", websocket.Subprotocols(r), "remote_addr", r.RemoteAddr)
+	http.Error(w, "Unsupported WebSocket subprotocol", http.StatusBadRequest)
+	return false
+}
+
+// clientIDFromRequest resolves the client identifier for a new connection
+// The client_id query parameter takes precedence over the X-Client-ID header
+// A random ID is generated when neither is provided
+func clientIDFromRequest(r *http.Request) string {
+	if id := r.URL.Query().Get("client_id"); id != "" {
+		return id
+	}
+	if id := r.Header.Get("X-Client-ID"); id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
+
+// replaceClient evicts the registered client with the given ID so a new
+// connection from the same user can claim the ID, reporting whether it could
+// Without an Authenticator every user ID is empty, so any reconnect matches
+func (h *Hub) replaceClient(id, userID string) bool {
+	old, ok := h.lookup(id)
+	if !ok || old.userID != userID {
+		return false
+	}
+	if h.evict(old, EvictReplaced, websocket.ClosePolicyViolation, replacedReason) {
+		old.log.Info("WebSocket client replaced by a new connection")
+	}
+	return h.claimID(id)
+}
+
+// recoverPanic stops a panic in one of the client's goroutines from crashing
+// the process; the panic is logged and only this client is disconnected
+// Must be deferred directly by the pump
+func (c *Client) recoverPanic(pump string) {
+	if r := recover(); r != nil {
+		c.log.Error("WebSocket client goroutine panicked", "pump", pump, "panic", r, "stack", string(debug.Stack()))
+		c.hub.closeClient(c, websocket.CloseInternalServerErr, "internal server error")
+	}
 }
 
 // readPump pumps messages from the WebSocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		close(c.readDone)
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+			c.hub.removeClient(c)
+		}
 		c.conn.Close()
+		close(c.inbound)
+		c.hub.pumps.Done()
 	}()
+	defer c.recoverPanic("read")
 
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	if err := c.setReadDeadline(); err != nil {
+		c.deadlineFailed(err)
+		return
+	}
+	c.conn.SetReadLimit(c.hub.config.MaxMessageSize)
+	c.conn.SetPongHandler(func(appData string) error {
+		// A failure here ends ReadMessage with the error
+		if err := c.setReadDeadline(); err != nil {
+			return err
+		}
+		c.lastPong.Store(time.Now().UnixNano())
+		c.recordPong(appData)
 		return nil
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, payload, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+			if errors.Is(err, errDeadline) {
+				c.deadlineFailed(err)
+				break
+			}
+			if errors.Is(err, websocket.ErrReadLimit) {
+				// gorilla has already sent a CloseMessageTooBig frame
+				if c.hub.evict(c, EvictMessageTooBig, websocket.CloseMessageTooBig, "message too big") {
+					c.log.Warn("WebSocket client sent oversized message, disconnecting", "limit", c.hub.config.MaxMessageSize)
+				}
+				break
+			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				c.peerClosed.Store(true)
+			}
+			// A reply to our own close frame is expected whatever its code
+			if websocket.IsUnexpectedCloseError(err, c.hub.config.ExpectedCloseCodes...) && !c.isClosed() {
+				c.log.Error("WebSocket read error", "error", err)
 			}
 			break
 		}
+		if c.allowInbound() {
+			c.handleInbound(payload)
+		}
 	}
 }
 
 // writePump pumps messages from the hub to the WebSocket connection
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ping := time.NewTimer(c.hub.pingInterval())
 	defer func() {
-		ticker.Stop()
+		ping.Stop()
 		c.conn.Close()
+		c.reportUndelivered()
+		c.hub.pumps.Done()
 	}()
+	defer c.recoverPanic("write")
+
+	// Idle checks only run when IdleTimeout is set; a nil channel never fires
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if c.hub.config.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(c.hub.config.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	var expired <-chan time.Time
+	if !c.expiresAt.IsZero() {
+		ageTimer := time.NewTimer(time.Until(c.expiresAt))
+		defer ageTimer.Stop()
+		expired = ageTimer.C
+	}
 
 	for {
+		// Drain the high-priority lane before waiting on anything else
+		select {
+		case message := <-c.sendHigh:
+			if !c.writeLane(message, c.sendHigh) {
+				return
+			}
+			continue
+		default:
+		}
+
 		select {
+		case message := <-c.sendHigh:
+			if !c.writeLane(message, c.sendHigh) {
+				return
+			}
+
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// Hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// Hub closed the channel; nothing is queued on sendHigh once
+				// the client is closed, so flush what is left there first
+				if !c.flushHigh() {
+					return
+				}
+				if err := c.setWriteDeadline(); err != nil {
+					c.deadlineFailed(err)
+					return
+				}
+				if c.hub.config.SendCloseNotice {
+					c.writeCloseNotice()
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
+				c.awaitCloseReply()
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if !c.writeLane(message, c.send) {
 				return
 			}
-			w.Write(message)
 
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+		case <-expired:
+			c.expire()
+			expired = nil
+
+		case <-idle:
+			if wait := c.checkIdle(); wait > 0 {
+				idleTimer.Reset(wait)
+			} else {
+				idle = nil
 			}
 
-			if err := w.Close(); err != nil {
+		case <-ping.C:
+			if err := c.setWriteDeadline(); err != nil {
+				c.writeFailed(err)
 				return
 			}
-
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.conn.WriteMessage(websocket.PingMessage, pingPayload(time.Now())); err != nil {
+				c.writeFailed(err)
 				return
 			}
+			ping.Reset(c.hub.pingInterval())
+		}
+	}
+}
+
+// writeLane writes message along with text messages queued behind it on lane
+// Returns false after handling a write error, once writePump should exit
+func (c *Client) writeLane(message outbound, lane chan outbound) bool {
+	if err := c.setWriteDeadline(); err != nil {
+		c.writeFailed(err)
+		return false
+	}
+	if err := c.writeQueued(message, lane); err != nil {
+		c.writeFailed(err)
+		return false
+	}
+	c.touch()
+	return true
+}
+
+// flushHigh writes every message left on the high-priority lane
+func (c *Client) flushHigh() bool {
+	for {
+		select {
+		case message := <-c.sendHigh:
+			if !c.writeLane(message, c.sendHigh) {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// writeQueued writes a message to the connection, coalescing any text
+// messages queued behind it on lane into the same frame separated by newlines
+// Binary messages are always written as their own frame, and streams as
+// their own run of messages
+func (c *Client) writeQueued(message outbound, lane chan outbound) error {
+	for {
+		if message.stream != nil {
+			return c.writeStream(message.stream)
+		}
+		if message.expired() {
+			c.hub.counters.messagesExpired.Add(1)
+			return nil
+		}
+
+		compressed, written := c.startWrite(message)
+		c.track(message.data)
+		if message.messageType == websocket.BinaryMessage {
+			if err := c.conn.WriteMessage(websocket.BinaryMessage, message.data); err != nil {
+				return err
+			}
+			c.finishWrite(compressed, len(message.data), written)
+			c.hub.countWritten(1, len(message.data))
+			c.inflight = c.inflight[:0]
+			return nil
+		}
+
+		w, err := c.conn.NextWriter(websocket.TextMessage)
+		if err != nil {
+			return err
+		}
+		w.Write(message.data)
+		payload := len(message.data)
+		messages := 1
+
+		// Add queued text messages to the current websocket message,
+		// stopping at a binary message, stream or change of compression so
+		// it gets frames of its own
+		var next *outbound
+		n := min(len(lane), c.hub.config.MaxCoalescedMessages-1)
+		if c.hub.config.DisableCoalescing {
+			n = 0
+		}
+		for i := 0; i < n; i++ {
+			// Only writePump receives from lane, so the n messages counted are
+			// still buffered even if the hub closes send meanwhile; a closed
+			// lane is checked for anyway so it can never add an empty line
+			queued, ok := <-lane
+			if !ok {
+				break
+			}
+			if queued.expired() {
+				c.hub.counters.messagesExpired.Add(1)
+				continue
+			}
+			if queued.messageType == websocket.BinaryMessage || queued.stream != nil ||
+				queued.noCompress != message.noCompress {
+				next = &queued
+				break
+			}
+			w.Write([]byte{'\n'})
+			w.Write(queued.data)
+			payload += 1 + len(queued.data)
+			messages++
+			c.track(queued.data)
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+		c.finishWrite(compressed, payload, written)
+		// Newline separators aren't message bytes
+		c.hub.countWritten(messages, payload-(messages-1))
+		c.inflight = c.inflight[:0]
+		if next == nil {
+			return nil
+		}
+
+		message = *next
+		if err := c.setWriteDeadline(); err != nil {
+			return err
 		}
 	}
 }
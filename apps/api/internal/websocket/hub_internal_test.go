@@ -0,0 +1,213 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stallReader is a stream source whose first read waits for release
+type stallReader struct {
+	reading chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	r.once.Do(func() { close(r.reading) })
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestWriteQueuedFlushesWhenSendClosesWithMessagesQueued(t *testing.T) {
+	h, err := NewHubWithConfig(Config{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	go h.Run()
+	defer h.Shutdown()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWS))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?client_id=queued", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	var client *Client
+	for deadline := time.Now().Add(2 * time.Second); client == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("client was never registered")
+		}
+		client, _ = h.lookup("queued")
+		time.Sleep(time.Millisecond)
+	}
+
+	// Hold writePump in a stream so broadcasts pile up behind it
+	stall := &stallReader{reading: make(chan struct{}), release: make(chan struct{})}
+	if err := h.SendStream("queued", "file", stall); err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	<-stall.reading
+	const queued = 5
+	for i := range queued {
+		if n, err := h.BroadcastMessageN("msg", i); err != nil || n != 1 {
+			t.Fatalf("BroadcastMessageN = %d, %v", n, err)
+		}
+	}
+
+	// Close send with the broadcasts still queued, then let writePump go on
+	h.closeClient(client, websocket.CloseNormalClosure, "bye")
+	close(stall.release)
+
+	var lines [][]byte
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("ReadMessage: %v, want a normal close after the messages", err)
+			}
+			break
+		}
+		lines = append(lines, bytes.Split(data, []byte{'\n'})...)
+	}
+
+	// The stream's end marker, then every queued broadcast in order
+	if len(lines) != queued+1 {
+		t.Fatalf("got %d messages, want %d: %q", len(lines), queued+1, lines)
+	}
+	for i, line := range lines {
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			t.Fatalf("message %d %q: %v", i, line, err)
+		}
+		if i == 0 {
+			if msg.Type != streamEndType {
+				t.Fatalf("first message type = %q, want %q", msg.Type, streamEndType)
+			}
+			continue
+		}
+		if msg.Type != "msg" || string(msg.Data) != strconv.Itoa(i-1) {
+			t.Fatalf("message %d = %s, want msg %d", i, line, i-1)
+		}
+	}
+}
+
+func TestBlockOnFullDoesNotDeadlockHubLoopPublishes(t *testing.T) {
+	h, err := NewHubWithConfig(Config{
+		Logger:          slog.New(slog.DiscardHandler),
+		BroadcastBuffer: 1,
+		BroadcastMode:   BlockOnFull,
+		ReplayBuffer:    8,
+		EnablePresence:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+
+	// Hold the hub loop in OnConnect while a producer fills the channel
+	connecting := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	h.OnConnect(func(*Client) {
+		once.Do(func() {
+			close(connecting)
+			<-release
+		})
+	})
+	go h.Run()
+	defer h.Shutdown()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWS))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	<-connecting
+
+	// The first broadcast fills the channel and the second waits for room
+	sent := make(chan error, 1)
+	go func() {
+		for i := range 2 {
+			if err := h.BroadcastMessage("msg", i); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+	for atomic.LoadUint64(&h.seq) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Announcing the connection publishes from the hub loop, which must not
+	// wait behind the blocked producer
+	close(release)
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("BroadcastMessage: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("hub loop deadlocked with a producer blocked under BlockOnFull")
+	}
+}
+
+func TestHelloTimerStoppedWhenClientLeavesBeforeHello(t *testing.T) {
+	h, err := NewHubWithConfig(Config{
+		Logger:       slog.New(slog.DiscardHandler),
+		RequireHello: true,
+		HelloTimeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	go h.Run()
+	defer h.Shutdown()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWS))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?client_id=silent", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	var client *Client
+	for deadline := time.Now().Add(2 * time.Second); client == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("client was never registered")
+		}
+		client, _ = h.lookup("silent")
+		time.Sleep(time.Millisecond)
+	}
+
+	conn.Close()
+	stopped := func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.closed && client.helloTimer == nil
+	}
+	for deadline := time.Now().Add(2 * time.Second); !stopped(); {
+		if time.Now().After(deadline) {
+			t.Fatal("hello timer still running after the client disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,247 @@
+package websocket_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+	"github.com/yourorg/nous/internal/websocket/wstest"
+)
+
+// startHub runs a hub with cfg and serves it in memory until the test ends
+// Each setup func runs before Run, e.g. to register callbacks
+func startHub(t *testing.T, cfg ws.Config, setup ...func(*ws.Hub)) (*ws.Hub, *wstest.Server) {
+	t.Helper()
+	hub, err := ws.NewHubWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	for _, fn := range setup {
+		fn(hub)
+	}
+	go hub.Run()
+	srv := wstest.NewServer(hub)
+	t.Cleanup(func() {
+		srv.Close()
+		hub.Shutdown()
+	})
+	return hub, srv
+}
+
+// dial connects a test client, failing the test if it can't
+func dial(t *testing.T, srv *wstest.Server, clientID string) *wstest.Client {
+	t.Helper()
+	client, err := srv.Dial(clientID)
+	if err != nil {
+		t.Fatalf("Dial(%q): %v", clientID, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// waitFor polls cond until it holds, failing the test after two seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// userHeaderAuth authenticates each connection as the user in its X-User header
+func userHeaderAuth(r *http.Request) (string, error) {
+	return r.Header.Get("X-User"), nil
+}
+
+// dialAs connects a test client authenticated as user
+func dialAs(srv *wstest.Server, clientID, user string) (*wstest.Client, error) {
+	return srv.DialHeader(clientID, http.Header{"X-User": {user}})
+}
+
+func TestServeWSReplacesConnectionOnReconnect(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{Authenticator: userHeaderAuth})
+	stale, err := dialAs(srv, "phone", "alice")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer stale.Close()
+
+	// The network dropped without the hub noticing; the app reconnects
+	fresh, err := dialAs(srv, "phone", "alice")
+	if err != nil {
+		t.Fatalf("reconnect Dial: %v", err)
+	}
+	defer fresh.Close()
+
+	if _, err := stale.Next(time.Second); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("stale connection Next error = %v, want a policy-violation close", err)
+	}
+	if n := hub.GetClientCount(); n != 1 {
+		t.Fatalf("client count = %d, want 1", n)
+	}
+	if n := hub.Stats().ClientsReplaced; n != 1 {
+		t.Fatalf("ClientsReplaced = %d, want 1", n)
+	}
+	if err := hub.SendToClient("phone", "ping", nil); err != nil {
+		t.Fatalf("SendToClient: %v", err)
+	}
+	msg, err := fresh.Next(time.Second)
+	if err != nil || msg.Type != "ping" {
+		t.Fatalf("Next = %+v, %v; want the ping on the new connection", msg, err)
+	}
+}
+
+func TestServeWSRejectsClientIDOfAnotherUser(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{Authenticator: userHeaderAuth})
+	owner, err := dialAs(srv, "phone", "alice")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer owner.Close()
+
+	_, err = dialAs(srv, "phone", "mallory")
+	if err == nil || !strings.Contains(err.Error(), "409") {
+		t.Fatalf("second Dial error = %v, want status %d", err, http.StatusConflict)
+	}
+	if n := hub.GetClientCount(); n != 1 {
+		t.Fatalf("client count = %d, want 1", n)
+	}
+	if err := hub.SendToClient("phone", "ping", nil); err != nil {
+		t.Fatalf("SendToClient: %v", err)
+	}
+	msg, err := owner.Next(time.Second)
+	if err != nil || msg.Type != "ping" {
+		t.Fatalf("Next = %+v, %v; want the ping on the original connection", msg, err)
+	}
+}
+
+func TestServeWSReleasesClientIDOnDisconnect(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	first := dial(t, srv, "same")
+	first.Close()
+
+	waitFor(t, "the first connection to unregister", func() bool { return hub.GetClientCount() == 0 })
+
+	second := dial(t, srv, "same")
+	if err := hub.SendToClient("same", "ping", nil); err != nil {
+		t.Fatalf("SendToClient: %v", err)
+	}
+	msg, err := second.Next(time.Second)
+	if err != nil || msg.Type != "ping" {
+		t.Fatalf("Next = %+v, %v; want a ping", msg, err)
+	}
+}
+
+func TestBroadcastBinarySendsBinaryFrame(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	client := dial(t, srv, "")
+
+	payload := []byte{0x82, 0xa4, 't', 'y', 'p', 'e', 0xff, 0x00}
+	hub.BroadcastBinary(payload)
+	if err := hub.BroadcastMessage("after", nil); err != nil {
+		t.Fatalf("BroadcastMessage: %v", err)
+	}
+
+	conn := client.Conn()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Fatalf("message type = %d, want BinaryMessage", messageType)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatalf("data = %x, want %x", data, payload)
+	}
+
+	// A text message queued behind it gets a frame of its own
+	messageType, _, err = conn.ReadMessage()
+	if err != nil || messageType != websocket.TextMessage {
+		t.Fatalf("second message type = %d (%v), want TextMessage", messageType, err)
+	}
+}
+
+func TestPanickingHandlerDisconnectsOnlyItsClient(t *testing.T) {
+	// Keep the expected panic and its stack out of the test output
+	hub, err := ws.NewHubWithConfig(ws.Config{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	hub.OnMessage(func(c *ws.Client, msg ws.Message) {
+		if msg.Type == "boom" {
+			panic("handler bug")
+		}
+	})
+	go hub.Run()
+	srv := wstest.NewServer(hub)
+	t.Cleanup(func() {
+		srv.Close()
+		hub.Shutdown()
+	})
+
+	crashing := dial(t, srv, "crashing")
+	healthy := dial(t, srv, "healthy")
+
+	if err := crashing.Send("boom", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	waitFor(t, "the panicking client to be disconnected", func() bool { return hub.GetClientCount() == 1 })
+	if _, err := crashing.Next(time.Second); !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+		t.Fatalf("panicking client read error = %v, want close %d", err, websocket.CloseInternalServerErr)
+	}
+
+	if err := hub.BroadcastMessage("still-up", nil); err != nil {
+		t.Fatalf("BroadcastMessage: %v", err)
+	}
+	msg, err := healthy.Next(time.Second)
+	if err != nil || msg.Type != "still-up" {
+		t.Fatalf("healthy client Next = %+v, %v; want the broadcast", msg, err)
+	}
+}
+
+func TestServeWSTimesOutWhenHubIsNotRunning(t *testing.T) {
+	// Run is never started, so nothing takes the registration
+	hub, err := ws.NewHubWithConfig(ws.Config{
+		RegisterTimeout: 50 * time.Millisecond,
+		MaxClients:      1,
+		Logger:          slog.New(slog.DiscardHandler),
+	})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(hub.ServeWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?client_id=waiting"
+
+	// The second attempt is only upgraded if the first released its slot and ID
+	for attempt := 1; attempt <= 2; attempt++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("attempt %d: Dial: %v", attempt, err)
+		}
+
+		start := time.Now()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err = conn.ReadMessage()
+		conn.Close()
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater {
+			t.Fatalf("attempt %d: ReadMessage error = %v, want close %d", attempt, err, websocket.CloseTryAgainLater)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("attempt %d: closed after %v, want about RegisterTimeout", attempt, elapsed)
+		}
+	}
+}
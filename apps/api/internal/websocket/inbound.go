@@ -0,0 +1,131 @@
+package websocket
+
+import "encoding/json"
+
+// Number of decoded inbound messages buffered per client awaiting dispatch
+const inboundBufferSize = 64
+
+// MessageHandler processes a message received from a client
+type MessageHandler func(c *Client, msg Message)
+
+// Middleware wraps inbound message handling; it may call next to continue
+// or return without calling it to reject the message
+type Middleware func(next MessageHandler) MessageHandler
+
+// InboundHandler processes the payload of one type of client message
+// data is the raw JSON so each handler can unmarshal it into its own type
+type InboundHandler func(c *Client, data json.RawMessage)
+
+// inboundMessage is the wire form of a client message
+// Data is kept raw so handlers can unmarshal it into their own types
+type inboundMessage struct {
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+	Channel string          `json:"channel,omitempty"`
+
+	// Correlation ID and method of rpc requests
+	ID     string `json:"id,omitempty"`
+	Method string `json:"method,omitempty"`
+}
+
+// OnMessage registers the default handler, invoked for each message whose
+// type has no handler registered with Handle
+// The message's Data field holds the raw JSON payload as a json.RawMessage
+// Handlers run on a per-client dispatch goroutine, so a slow handler delays
+// that client's subsequent messages but never blocks the socket read loop
+// Must be called before the hub starts serving connections
+func (h *Hub) OnMessage(handler MessageHandler) {
+	h.onMessage = handler
+}
+
+// Handle registers the handler for client messages of the given type,
+// replacing any earlier handler for it. Messages of types with no handler go
+// to the OnMessage handler, or are logged and ignored if there is none
+// Handlers run on the client's dispatch goroutine, as with OnMessage
+// Must be called before the hub starts serving connections
+func (h *Hub) Handle(msgType string, handler InboundHandler) {
+	h.handlers[msgType] = handler
+}
+
+// Use adds middleware around every inbound message handler: those registered
+// with Handle, the OnMessage default and the hub's own message types (hello,
+// ack, set_tag and the like), so it can reject any of them. Middleware runs
+// in the order it was added, so the first one sees each message first
+// Must be called before the hub starts serving connections
+func (h *Hub) Use(mw ...Middleware) {
+	h.middleware = append(h.middleware, mw...)
+}
+
+// dispatch passes a client message through the middleware to its handler
+func (h *Hub) dispatch(c *Client, msg Message) {
+	h.routeOnce.Do(func() {
+		h.route = h.handle
+		for i := len(h.middleware) - 1; i >= 0; i-- {
+			h.route = h.middleware[i](h.route)
+		}
+	})
+	h.route(c, msg)
+}
+
+// handle routes a client message to the handler registered for its type,
+// or to its channel's handlers if it was sent on one
+// The hub's own message types are handled here too, behind the middleware,
+// so it can reject them like any other message
+func (h *Hub) handle(c *Client, msg Message) {
+	if c.controlRequest(msg) || c.subscribeRequest(msg) || h.handleRPC(c, msg) {
+		return
+	}
+	if msg.Channel != "" {
+		if ch, ok := h.channel(msg.Channel); ok {
+			ch.handle(c, msg)
+		} else {
+			c.log.Debug("Ignoring WebSocket message on unknown channel", "type", msg.Type, "channel", msg.Channel)
+		}
+		return
+	}
+	if handler, ok := h.handlers[msg.Type]; ok {
+		data, _ := msg.Data.(json.RawMessage)
+		handler(c, data)
+		return
+	}
+	if h.onMessage != nil {
+		h.onMessage(c, msg)
+		return
+	}
+	c.log.Debug("Ignoring WebSocket message with no handler", "type", msg.Type)
+}
+
+// handleInbound decodes a raw client payload and queues it for dispatch
+// Malformed payloads are logged and skipped without closing the connection
+func (c *Client) handleInbound(payload []byte) {
+	var in inboundMessage
+	if err := json.Unmarshal(payload, &in); err != nil {
+		c.log.Warn("WebSocket client sent malformed message", "error", err)
+		return
+	}
+	c.touch()
+
+	select {
+	case c.inbound <- Message{Type: in.Type, Data: in.Data, Channel: in.Channel, ID: in.ID, Method: in.Method}:
+	default:
+		c.log.Warn("WebSocket client inbound queue full, dropping message", "type", in.Type)
+	}
+}
+
+// controlRequest handles the hub's own client message types, reporting
+// whether msg was one of them
+func (c *Client) controlRequest(msg Message) bool {
+	return c.requestHello(msg) || c.requestResume(msg) || c.requestSetTag(msg) || c.requestAck(msg) ||
+		c.requestCapabilities(msg) || c.requestPause(msg) || c.requestCount(msg)
+}
+
+// dispatchPump delivers decoded inbound messages to the hub's handlers
+// It exits once readPump closes the inbound channel
+func (c *Client) dispatchPump() {
+	defer c.hub.pumps.Done()
+	defer c.recoverPanic("dispatch")
+
+	for msg := range c.inbound {
+		c.hub.dispatch(c, msg)
+	}
+}
@@ -0,0 +1,72 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+	"github.com/yourorg/nous/internal/websocket/wstest"
+)
+
+func TestMiddlewareWrapsControlMessages(t *testing.T) {
+	hub, err := ws.NewHubWithConfig(ws.Config{})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	seen := make(chan string, 16)
+	hub.Use(func(next ws.MessageHandler) ws.MessageHandler {
+		return func(c *ws.Client, msg ws.Message) {
+			seen <- c.ID() + " " + msg.Type
+			if c.ID() == "untrusted" {
+				return
+			}
+			next(c, msg)
+		}
+	})
+	go hub.Run()
+	srv := wstest.NewServer(hub)
+	t.Cleanup(func() {
+		srv.Close()
+		hub.Shutdown()
+	})
+
+	trusted := dial(t, srv, "trusted")
+	untrusted := dial(t, srv, "untrusted")
+	tag := map[string]string{"key": "role", "value": "admin"}
+	for _, client := range []*wstest.Client{trusted, untrusted} {
+		if err := client.Send("set_tag", tag); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	want := map[string]bool{"trusted set_tag": true, "untrusted set_tag": true}
+	for range want {
+		select {
+		case got := <-seen:
+			if !want[got] {
+				t.Fatalf("middleware saw %q", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("middleware never saw the set_tag messages")
+		}
+	}
+
+	waitFor(t, "the trusted client's tag", func() bool {
+		return tagged(hub, "trusted")
+	})
+	if tagged(hub, "untrusted") {
+		t.Fatal("rejected set_tag was applied")
+	}
+}
+
+// tagged reports whether the client with the given ID has role=admin
+func tagged(hub *ws.Hub, id string) bool {
+	tagged := false
+	hub.Range(func(c *ws.Client) bool {
+		if c.ID() == id {
+			tagged = c.HasTag("role", "admin")
+		}
+		return true
+	})
+	return tagged
+}
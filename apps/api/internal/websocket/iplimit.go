@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+)
+
+// clientIP returns the address used for per-IP connection limits
+// X-Forwarded-For is only consulted when Config.TrustForwardedFor is set,
+// since clients can forge it when not behind a proxy
+func (h *Hub) clientIP(r *http.Request) string {
+	if h.config.TrustForwardedFor {
+		if ip := forwardedValue(r.Header.Get("X-Forwarded-For")); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acquireIP reserves a connection for ip, enforcing MaxConnectionsPerIP
+func (h *Hub) acquireIP(ip string) bool {
+	if h.config.MaxConnectionsPerIP <= 0 {
+		return true
+	}
+
+	h.ipMu.Lock()
+	defer h.ipMu.Unlock()
+
+	if h.ipConns[ip] >= h.config.MaxConnectionsPerIP {
+		return false
+	}
+	h.ipConns[ip]++
+	return true
+}
+
+// releaseIP frees a connection taken by acquireIP
+func (h *Hub) releaseIP(ip string) {
+	if h.config.MaxConnectionsPerIP <= 0 {
+		return
+	}
+
+	h.ipMu.Lock()
+	defer h.ipMu.Unlock()
+
+	if h.ipConns[ip] <= 1 {
+		delete(h.ipConns, ip)
+		return
+	}
+	h.ipConns[ip]--
+}
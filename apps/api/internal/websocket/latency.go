@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Weight of the newest sample in the per-client latency moving average
+const latencySmoothing = 0.2
+
+// pingPayload encodes the send time in the ping so the pong carries it back
+func pingPayload(now time.Time) []byte {
+	return strconv.AppendInt(nil, now.UnixNano(), 10)
+}
+
+// recordPong updates the client's moving-average round-trip time from a pong
+// whose payload was produced by pingPayload; other payloads are ignored
+func (c *Client) recordPong(appData string) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+
+	for {
+		prev := c.latency.Load()
+		next := int64(rtt)
+		if prev != 0 {
+			next = int64(latencySmoothing*float64(rtt) + (1-latencySmoothing)*float64(prev))
+		}
+		if c.latency.CompareAndSwap(prev, next) {
+			return
+		}
+	}
+}
+
+// Latency returns the client's moving-average ping round-trip time
+// Zero means no pong has been received yet
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.latency.Load())
+}
+
+// LatencyStats summarizes round-trip times across measured clients
+type LatencyStats struct {
+	P50 time.Duration `json:"p50_ns"`
+	P95 time.Duration `json:"p95_ns"`
+	P99 time.Duration `json:"p99_ns"`
+}
+
+// latencyStats computes latency percentiles over clients that have reported a pong
+func (h *Hub) latencyStats() LatencyStats {
+	samples := make([]time.Duration, 0)
+	for _, client := range h.snapshot() {
+		if latency := client.Latency(); latency > 0 {
+			samples = append(samples, latency)
+		}
+	}
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	slices.Sort(samples)
+	percentile := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+	return LatencyStats{
+		P50: percentile(0.50),
+		P95: percentile(0.95),
+		P99: percentile(0.99),
+	}
+}
+
+// pingInterval returns the time until a client's next ping: PingPeriod less
+// a random share of PingJitter percent of it
+func (h *Hub) pingInterval() time.Duration {
+	period := h.config.PingPeriod
+	if h.config.PingJitter == 0 {
+		return period
+	}
+	return period - rand.N(period*time.Duration(h.config.PingJitter)/100+1)
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingIntervalJitter(t *testing.T) {
+	const period = time.Second
+	hub, err := NewHubWithConfig(Config{PingPeriod: period, PingJitter: 20})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+
+	const samples = 1000
+	shortest, longest := period, time.Duration(0)
+	distinct := make(map[time.Duration]bool)
+	for range samples {
+		interval := hub.pingInterval()
+		if interval > period || interval < period*80/100 {
+			t.Fatalf("interval %v outside [%v, %v]", interval, period*80/100, period)
+		}
+		shortest, longest = min(shortest, interval), max(longest, interval)
+		distinct[interval] = true
+	}
+
+	// Spread across most of the 200ms jitter window rather than clumped
+	if spread := longest - shortest; spread < period*15/100 {
+		t.Fatalf("intervals only spread over %v", spread)
+	}
+	if len(distinct) < samples/2 {
+		t.Fatalf("only %d distinct intervals in %d samples", len(distinct), samples)
+	}
+}
+
+func TestPingIntervalWithoutJitter(t *testing.T) {
+	hub, err := NewHubWithConfig(Config{PingPeriod: time.Second})
+	if err != nil {
+		t.Fatalf("NewHubWithConfig: %v", err)
+	}
+	for range 10 {
+		if interval := hub.pingInterval(); interval != time.Second {
+			t.Fatalf("interval = %v, want PingPeriod", interval)
+		}
+	}
+}
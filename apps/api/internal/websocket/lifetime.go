@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// idleReason is sent in the close frame when a client exceeds Config.IdleTimeout
+	idleReason = "idle timeout"
+
+	// maxAgeReason is sent in the close frame when a client exceeds Config.MaxConnectionAge
+	maxAgeReason = "connection max age reached, please reconnect"
+)
+
+// connectionDeadline returns when a connection opened at start must be
+// recycled, or the zero time when MaxConnectionAge is unset
+// A random share of MaxConnectionAgeJitter spreads out reconnects
+func (h *Hub) connectionDeadline(start time.Time) time.Time {
+	if h.config.MaxConnectionAge <= 0 {
+		return time.Time{}
+	}
+
+	age := h.config.MaxConnectionAge
+	if jitter := h.config.MaxConnectionAgeJitter; jitter > 0 {
+		age += rand.N(jitter)
+	}
+	return start.Add(age)
+}
+
+// expire closes a client that reached its maximum connection age
+func (c *Client) expire() {
+	c.log.Info("Closing WebSocket client at max connection age", "age", time.Since(c.connectedAt))
+	c.hub.closeClient(c, websocket.CloseServiceRestart, maxAgeReason)
+}
+
+// touch records application-level activity for the idle timeout
+func (c *Client) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor reports how long the client has had no application-level activity
+func (c *Client) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastActivity.Load()))
+}
+
+// checkIdle closes the client if it has been idle for Config.IdleTimeout
+// Returns how long to wait before checking again, or zero once closed
+func (c *Client) checkIdle() time.Duration {
+	timeout := c.hub.config.IdleTimeout
+	idle := c.idleFor()
+	if idle < timeout {
+		return timeout - idle
+	}
+
+	c.log.Info("Closing idle WebSocket client", "idle", idle)
+	c.hub.closeClient(c, websocket.CloseNormalClosure, idleReason)
+	return 0
+}
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// migrateMessageType tells a client to reconnect to another endpoint
+	migrateMessageType = "migrate"
+
+	// Reason sent in the close frame of clients still connected after a migration
+	migrateReason = "server migrating"
+)
+
+// Migration is the payload of a migrate message
+type Migration struct {
+	// URL is the endpoint the client should reconnect to
+	URL string `json:"url"`
+
+	// ReconnectAfterMs is how long the client should wait before
+	// reconnecting, in milliseconds
+	ReconnectAfterMs int64 `json:"reconnect_after_ms"`
+}
+
+// Migrate hands clients off to another endpoint for zero-downtime deploys
+// It stops accepting new connections, sends every client a migrate message
+// carrying newURL and a reconnect delay staggered across within so they
+// don't all reconnect at once, then waits up to within for clients to
+// leave before draining the rest with CloseServiceRestart
+// Blocks until done and returns how many clients had to be force-closed
+func (h *Hub) Migrate(newURL string, within time.Duration) int {
+	h.draining.Store(true)
+
+	clients := h.snapshot()
+	for i, client := range clients {
+		delay := within * time.Duration(i) / time.Duration(len(clients))
+		frame, err := h.encode(Message{
+			Type: migrateMessageType,
+			Data: Migration{URL: newURL, ReconnectAfterMs: delay.Milliseconds()},
+		})
+		if err != nil {
+			h.logger.Error("Error marshaling WebSocket message", "type", migrateMessageType, "error", err)
+			break
+		}
+		frame.priority = PriorityHigh
+		h.deliver(client, frame)
+	}
+	h.logger.Info("WebSocket hub migrating clients", "url", newURL, "clients", len(clients), "within", within)
+
+	deadline := time.Now().Add(within)
+	for h.GetClientCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	return h.drainClients(shutdownDrainTimeout, websocket.CloseServiceRestart, migrateReason)
+}
@@ -0,0 +1,191 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Inbound control messages joining and leaving a channel, e.g.
+// {"type":"subscribe","channel":"logs"}
+const (
+	channelSubscribeType   = "subscribe"
+	channelUnsubscribeType = "unsubscribe"
+)
+
+// Channel is a logical hub multiplexed over the hub's connections, so one
+// socket can carry e.g. logs, metrics and chat. Messages to and from a
+// channel name it in Message.Channel; clients join and leave it with
+// subscribe and unsubscribe messages carrying the channel name
+type Channel struct {
+	hub  *Hub
+	name string
+
+	// Inbound handlers for messages sent on this channel
+	handlers  map[string]InboundHandler
+	onMessage MessageHandler
+
+	// Clients subscribed to the channel
+	members map[*Client]bool
+	mu      sync.RWMutex
+}
+
+// Channel returns the logical channel with the given name, creating it the
+// first time. Subscribe requests for channels that don't exist are ignored
+func (h *Hub) Channel(name string) *Channel {
+	h.channelsMu.Lock()
+	defer h.channelsMu.Unlock()
+	if ch, ok := h.channels[name]; ok {
+		return ch
+	}
+	ch := &Channel{
+		hub:      h,
+		name:     name,
+		handlers: make(map[string]InboundHandler),
+		members:  make(map[*Client]bool),
+	}
+	h.channels[name] = ch
+	return ch
+}
+
+// channel returns the channel with the given name, if it exists
+func (h *Hub) channel(name string) (*Channel, bool) {
+	h.channelsMu.RLock()
+	defer h.channelsMu.RUnlock()
+	ch, ok := h.channels[name]
+	return ch, ok
+}
+
+// Name returns the channel's name
+func (ch *Channel) Name() string {
+	return ch.name
+}
+
+// Handle registers the handler for messages of the given type sent on the
+// channel, like Hub.Handle; the hub's middleware runs first
+// Must be called before the hub starts serving connections
+func (ch *Channel) Handle(msgType string, handler InboundHandler) {
+	ch.handlers[msgType] = handler
+}
+
+// OnMessage registers the channel's default handler, invoked for messages
+// sent on it whose type has no handler registered with Handle
+// Must be called before the hub starts serving connections
+func (ch *Channel) OnMessage(handler MessageHandler) {
+	ch.onMessage = handler
+}
+
+// Subscribe adds a client to the channel
+func (ch *Channel) Subscribe(c *Client) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	// Checked under the lock so a client closing concurrently isn't left behind
+	if ch.hub.registered(c) {
+		ch.members[c] = true
+	}
+}
+
+// Unsubscribe removes a client from the channel
+func (ch *Channel) Unsubscribe(c *Client) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	delete(ch.members, c)
+}
+
+// Subscribed reports whether the client is subscribed to the channel
+func (ch *Channel) Subscribed(c *Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.members[c]
+}
+
+// ClientCount returns the number of clients subscribed to the channel
+func (ch *Channel) ClientCount() int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return len(ch.members)
+}
+
+// Broadcast sends a message on the channel to every client subscribed to it
+// Returns the number of clients it was queued to
+func (ch *Channel) Broadcast(eventType string, data interface{}) int {
+	ch.mu.RLock()
+	members := make([]*Client, 0, len(ch.members))
+	for client := range ch.members {
+		members = append(members, client)
+	}
+	ch.mu.RUnlock()
+
+	if len(members) == 0 {
+		return 0
+	}
+
+	message := Message{
+		Type:    eventType,
+		Data:    data,
+		Channel: ch.name,
+	}
+
+	frame, err := ch.hub.encodeLogged(message, "channel", ch.name)
+	if err != nil {
+		return 0
+	}
+
+	// Deliver without holding the lock, as deliver may evict a slow client
+	reached := 0
+	for _, client := range members {
+		if ch.hub.broadcastTo(client, frame) {
+			reached++
+		}
+	}
+	return reached
+}
+
+// handle routes a message sent on the channel to its handler
+func (ch *Channel) handle(c *Client, msg Message) {
+	if !ch.Subscribed(c) {
+		c.log.Debug("Ignoring WebSocket message on unsubscribed channel", "type", msg.Type, "channel", ch.name)
+		return
+	}
+	if handler, ok := ch.handlers[msg.Type]; ok {
+		data, _ := msg.Data.(json.RawMessage)
+		handler(c, data)
+		return
+	}
+	if ch.onMessage != nil {
+		ch.onMessage(c, msg)
+		return
+	}
+	c.log.Debug("Ignoring WebSocket message with no handler", "type", msg.Type, "channel", ch.name)
+}
+
+// subscribeRequest handles subscribe and unsubscribe control messages
+// They are dispatched in order with the client's other messages, so
+// middleware sees them and later messages observe the subscription
+// Returns false if the message is neither or names no channel, leaving it
+// to the hub's handlers
+func (c *Client) subscribeRequest(msg Message) bool {
+	if (msg.Type != channelSubscribeType && msg.Type != channelUnsubscribeType) || msg.Channel == "" {
+		return false
+	}
+
+	ch, ok := c.hub.channel(msg.Channel)
+	if !ok {
+		c.log.Warn("WebSocket client subscribed to unknown channel", "channel", msg.Channel)
+		return true
+	}
+	if msg.Type == channelSubscribeType {
+		ch.Subscribe(c)
+	} else {
+		ch.Unsubscribe(c)
+	}
+	return true
+}
+
+// leaveChannels removes a client from every channel once it has been unregistered
+func (h *Hub) leaveChannels(c *Client) {
+	h.channelsMu.RLock()
+	defer h.channelsMu.RUnlock()
+	for _, ch := range h.channels {
+		ch.Unsubscribe(c)
+	}
+}
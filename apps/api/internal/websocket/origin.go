@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// originWildcard allows any origin when present in the allowed list
+const originWildcard = "*"
+
+// originRule is a compiled allowed-origin entry
+// Entries containing "*" are glob patterns where each "*" matches one or
+// more characters within the host, e.g. "https://*.preview.example.com"
+type originRule struct {
+	pattern string
+	re      *regexp.Regexp // nil for exact-match entries
+}
+
+// matches reports whether origin satisfies the rule (host is case-insensitive)
+func (r originRule) matches(origin string) bool {
+	if r.pattern == originWildcard {
+		return true
+	}
+	if r.re != nil {
+		return r.re.MatchString(origin)
+	}
+	return strings.EqualFold(origin, r.pattern)
+}
+
+// compileOriginRule converts an allowed-origin entry into a rule
+func compileOriginRule(pattern string) (originRule, error) {
+	if pattern == originWildcard || !strings.Contains(pattern, "*") {
+		return originRule{pattern: pattern}, nil
+	}
+
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok || scheme == "" || strings.Contains(scheme, "*") {
+		return originRule{}, fmt.Errorf("websocket: invalid origin pattern %q: wildcards are only allowed in the host", pattern)
+	}
+
+	parts := strings.Split(host, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "(?i)^" + regexp.QuoteMeta(scheme) + "://" + strings.Join(parts, "[^/]+") + "$"
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return originRule{}, fmt.Errorf("websocket: invalid origin pattern %q: %w", pattern, err)
+	}
+	return originRule{pattern: pattern, re: re}, nil
+}
+
+// compileOriginRules compiles every allowed-origin entry once at hub creation
+// NewHubWithConfig rejects invalid patterns; any that get here are logged
+// and skipped so they never match
+func compileOriginRules(patterns []string, logger *slog.Logger) []originRule {
+	rules := make([]originRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule, err := compileOriginRule(pattern)
+		if err != nil {
+			logger.Warn("Ignoring allowed origin", "error", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// SetAllowedOrigins replaces the hub's allowed origins, taking the same
+// entries as Config.AllowedOrigins, e.g. to revoke an origin without a
+// restart. Only new upgrades use the new list; open connections are kept
+// Unlike the Config field, an empty list allows no origins
+// Returns an error, leaving the current list in place, if a pattern is invalid
+func (h *Hub) SetAllowedOrigins(origins []string) error {
+	rules := make([]originRule, 0, len(origins))
+	for _, pattern := range origins {
+		rule, err := compileOriginRule(pattern)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	h.originRules.Store(&rules)
+	h.logger.Info("WebSocket allowed origins updated", "origins", origins)
+	return nil
+}
+
+// checkOrigin reports whether the request's Origin header is allowed by the hub
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	// Requests with no origin come from non-browser clients (e.g., mobile apps,
+	// Postman) and are allowed unless the hub requires an origin
+	if origin == "" {
+		if h.config.RejectEmptyOrigin {
+			h.logger.Warn("WebSocket request without origin rejected", "remote_addr", r.RemoteAddr)
+			return false
+		}
+		return true
+	}
+
+	for _, rule := range *h.originRules.Load() {
+		if rule.matches(origin) {
+			h.logger.Info("WebSocket origin allowed", "origin", origin, "pattern", rule.pattern)
+			return true
+		}
+	}
+
+	if h.config.TrustForwardedHeaders && strings.EqualFold(origin, publicOrigin(r)) {
+		h.logger.Info("WebSocket origin allowed", "origin", origin, "pattern", "same-origin")
+		return true
+	}
+
+	h.logger.Warn("WebSocket origin rejected", "origin", origin, "remote_addr", r.RemoteAddr)
+	return false
+}
+
+// publicOrigin rebuilds the origin the client used to reach the server from
+// the X-Forwarded-Proto and X-Forwarded-Host headers set by a TLS-terminating
+// proxy, falling back to the request's own scheme and host
+func publicOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwardedValue(r.Header.Get("X-Forwarded-Proto")); proto != "" {
+		scheme = strings.ToLower(proto)
+	}
+
+	host := r.Host
+	if forwarded := forwardedValue(r.Header.Get("X-Forwarded-Host")); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+// forwardedValue returns the first entry of a comma-separated forwarding header
+func forwardedValue(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(first)
+}
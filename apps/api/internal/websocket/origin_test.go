@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com.evil.net", false},
+		{"*", "https://anything.example", true},
+		{"https://*.preview.example.com", "https://pr-42.preview.example.com", true},
+		{"https://*.preview.example.com", "https://A.B.preview.example.com", true},
+		{"https://*.preview.example.com", "https://preview.example.com", false},
+		{"https://*.preview.example.com", "https://evil.net/.preview.example.com", false},
+		{"https://*.preview.example.com", "http://pr-42.preview.example.com", false},
+		{"http://localhost:*", "http://localhost:5173", true},
+	}
+	for _, tt := range tests {
+		rule, err := compileOriginRule(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileOriginRule(%q): %v", tt.pattern, err)
+		}
+		if got := rule.matches(tt.origin); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCompileOriginRuleRejectsWildcardOutsideHost(t *testing.T) {
+	for _, pattern := range []string{"*://example.com", "example.*", "://*.example.com"} {
+		if _, err := compileOriginRule(pattern); err == nil {
+			t.Errorf("compileOriginRule(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		origin string
+		want   bool
+	}{
+		{"listed", Config{AllowedOrigins: []string{"https://app.example.com"}}, "https://app.example.com", true},
+		{"unlisted", Config{AllowedOrigins: []string{"https://app.example.com"}}, "https://evil.net", false},
+		{"empty allowed", Config{AllowedOrigins: []string{"https://app.example.com"}}, "", true},
+		{"empty rejected", Config{AllowedOrigins: []string{"*"}, RejectEmptyOrigin: true}, "", false},
+	}
+	for _, tt := range tests {
+		tt.cfg.Logger = slog.New(slog.DiscardHandler)
+		h, err := NewHubWithConfig(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: NewHubWithConfig: %v", tt.name, err)
+		}
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := h.checkOrigin(r); got != tt.want {
+			t.Errorf("%s: checkOrigin(%q) = %v, want %v", tt.name, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package websocket
+
+// Inbound control messages a client sends when it is backgrounded and
+// foregrounded, e.g. a hidden mobile tab ("resume" already requests replay)
+const (
+	pauseMessageType   = "pause"
+	unpauseMessageType = "unpause"
+)
+
+// Pause stops normal-priority broadcasts to the client until Resume; they are
+// skipped, not queued, so the client should resync (e.g. with a resume
+// request) when it resumes. High-priority broadcasts, and messages sent to
+// the client itself (SendToClient, replies, streams), still go through
+func (c *Client) Pause() {
+	if !c.paused.Swap(true) {
+		c.log.Debug("WebSocket client paused")
+	}
+}
+
+// Resume restarts delivery of normal-priority broadcasts after Pause
+func (c *Client) Resume() {
+	if c.paused.Swap(false) {
+		c.log.Debug("WebSocket client resumed")
+	}
+}
+
+// Paused reports whether the client is paused
+func (c *Client) Paused() bool {
+	return c.paused.Load()
+}
+
+// requestPause handles pause and unpause control messages
+// Returns false if the message is neither
+func (c *Client) requestPause(msg Message) bool {
+	switch msg.Type {
+	case pauseMessageType:
+		c.Pause()
+	case unpauseMessageType:
+		c.Resume()
+	default:
+		return false
+	}
+	return true
+}
+
+// skipsWhilePaused reports whether a broadcast should be withheld from c
+func (c *Client) skipsWhilePaused(message outbound) bool {
+	return message.priority != PriorityHigh && c.paused.Load()
+}
+
+// broadcastTo delivers a broadcast to one of its recipients, skipping a
+// paused client; messages meant for one client use deliver directly and
+// reach it either way
+func (h *Hub) broadcastTo(client *Client, message outbound) bool {
+	if client.skipsWhilePaused(message) {
+		return false
+	}
+	return h.deliver(client, message)
+}
+
+// pausedClients counts the registered clients that are paused
+func (h *Hub) pausedClients() int {
+	paused := 0
+	h.Range(func(c *Client) bool {
+		if c.Paused() {
+			paused++
+		}
+		return true
+	})
+	return paused
+}
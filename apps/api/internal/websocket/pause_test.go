@@ -0,0 +1,56 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+func TestPausedClientStillGetsDirectMessages(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	client := dial(t, srv, "paused")
+
+	if err := client.Send("pause", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	waitFor(t, "the client to pause", func() bool { return hub.Stats().PausedClients == 1 })
+
+	if _, err := hub.BroadcastMessageN("routine", nil); err != nil {
+		t.Fatalf("BroadcastMessageN: %v", err)
+	}
+	if err := hub.SendToClient("paused", "direct", nil); err != nil {
+		t.Fatalf("SendToClient: %v", err)
+	}
+	if err := client.Send("get_count", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// The routine broadcast is skipped; the rest arrive in order
+	for _, want := range []string{"direct", "count"} {
+		msg, err := client.Next(time.Second)
+		if err != nil || msg.Type != want {
+			t.Fatalf("Next = %+v, %v; want %s", msg, err, want)
+		}
+	}
+}
+
+func TestPausedClientSkipsNormalBroadcasts(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	client := dial(t, srv, "paused")
+
+	if err := client.Send("pause", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	waitFor(t, "the client to pause", func() bool { return hub.Stats().PausedClients == 1 })
+
+	if n, err := hub.BroadcastMessageN("routine", nil); err != nil || n != 0 {
+		t.Fatalf("BroadcastMessageN = %d, %v; want it to reach no one", n, err)
+	}
+	hub.BroadcastPriority(ws.PriorityHigh, "urgent", nil)
+
+	msg, err := client.Next(time.Second)
+	if err != nil || msg.Type != "urgent" {
+		t.Fatalf("Next = %+v, %v; want the high-priority broadcast", msg, err)
+	}
+}
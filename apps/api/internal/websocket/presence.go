@@ -0,0 +1,67 @@
+package websocket
+
+import "context"
+
+// Presence event names
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+// presenceMessageType is the message type used for presence announcements
+const presenceMessageType = "presence"
+
+// Presence is the payload of a presence message
+type Presence struct {
+	Event    string `json:"event"`
+	ClientID string `json:"client_id"`
+
+	// Topic is set when the event is scoped to a topic's subscribers
+	Topic string `json:"topic,omitempty"`
+
+	// Count is the number of connected clients, or of Topic subscribers when set
+	Count int `json:"count"`
+}
+
+// announceConnection tells every client that a client connected or disconnected
+// Only clients without topic subscriptions announce globally; a client in topics
+// announces its departure to those topics instead (see announceTopics)
+func (h *Hub) announceConnection(c *Client, event string, total int) {
+	if !h.config.EnablePresence || h.isDone() {
+		return
+	}
+	message := Message{
+		Type: presenceMessageType,
+		Data: Presence{
+			Event:    event,
+			ClientID: c.id,
+			Count:    total,
+		},
+	}
+
+	// This runs on the hub goroutine, which is what drains the broadcast
+	// channel, so it must never wait for room even under BlockOnFull
+	ok, err := h.publish(context.Background(), message, broadcastRequest{neverBlock: true})
+	if err != nil {
+		h.logger.Error("Error marshaling WebSocket message", "type", presenceMessageType, "error", err)
+		return
+	}
+	if !ok {
+		h.logger.Warn("WebSocket broadcast channel full, dropping message", "type", presenceMessageType)
+	}
+}
+
+// announceTopics tells the subscribers of each topic that a client joined or left it
+func (h *Hub) announceTopics(c *Client, event string, topics []string) {
+	if !h.config.EnablePresence || h.isDone() {
+		return
+	}
+	for _, topic := range topics {
+		h.BroadcastToTopic(topic, presenceMessageType, Presence{
+			Event:    event,
+			ClientID: c.id,
+			Topic:    topic,
+			Count:    h.topicSubscriberCount(topic),
+		})
+	}
+}
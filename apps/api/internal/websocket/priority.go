@@ -0,0 +1,26 @@
+package websocket
+
+// Priority selects the lane a broadcast is queued on in each client
+type Priority int
+
+const (
+	// PriorityNormal messages share the client's send buffer
+	PriorityNormal Priority = iota
+
+	// PriorityHigh messages are written before any queued normal messages
+	PriorityHigh
+)
+
+// BroadcastPriority sends a message to all connected clients on the given lane
+// High-priority messages skip ahead of normal messages already queued for a
+// client, so errors and shutdown notices aren't stuck behind bulk telemetry
+// Each lane is written in the order it was queued; across lanes a message may
+// arrive before lower-sequence normal messages, which clients should not
+// mistake for a gap. High-priority messages have their own buffer
+// (Config.HighPrioritySendBuffer) and only fall back to the normal lane and its
+// drop-on-full policy once it is full. Priority is local to this instance and
+// isn't carried over the backplane
+// This is thread-safe and non-blocking
+func (h *Hub) BroadcastPriority(priority Priority, eventType string, data interface{}) {
+	h.BroadcastWithOptions(BroadcastOptions{Priority: priority}, eventType, data)
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Window over which rate-limited messages are counted toward disconnection
+	rateLimitWindow = 10 * time.Second
+
+	// Reason sent in the close frame when a client is disconnected for flooding
+	rateLimitReason = "rate limit exceeded"
+)
+
+// rateLimiter is a token bucket limiting a client's inbound messages
+// It is only used from the client's readPump goroutine, so it needs no locking;
+// each connection gets a fresh limiter, so state never outlives a client
+type rateLimiter struct {
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// Drops counted in the current window for abuse detection
+	windowStart time.Time
+	windowDrops int
+}
+
+// newRateLimiter returns a limiter, or nil if rate limiting is disabled
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow consumes a token if one is available
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// recordDrop counts a rate-limited message and returns the drops in the current window
+func (l *rateLimiter) recordDrop(now time.Time) int {
+	if now.Sub(l.windowStart) > rateLimitWindow {
+		l.windowStart = now
+		l.windowDrops = 0
+	}
+	l.windowDrops++
+	return l.windowDrops
+}
+
+// allowInbound applies the hub's rate limit to an inbound message
+// A client that keeps exceeding the limit is evicted with a policy-violation
+// code, as EvictRateLimited
+func (c *Client) allowInbound() bool {
+	if c.limiter == nil {
+		return true
+	}
+
+	now := time.Now()
+	if c.limiter.allow(now) {
+		return true
+	}
+
+	c.hub.counters.inboundRateLimited.Add(1)
+	if drops := c.limiter.recordDrop(now); drops == c.hub.config.InboundRateLimitMaxDrops {
+		if c.hub.evict(c, EvictRateLimited, websocket.ClosePolicyViolation, rateLimitReason) {
+			c.log.Warn("WebSocket client exceeded inbound rate limit, disconnecting", "dropped", drops)
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsAtRateUpToBurst(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := l.last
+
+	for i := range 3 {
+		if !l.allow(now) {
+			t.Fatalf("message %d within the burst was refused", i)
+		}
+	}
+	if l.allow(now) {
+		t.Fatal("message beyond the burst was allowed")
+	}
+
+	// Two tokens a second: half a second earns exactly one message
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow(now) || l.allow(now) {
+		t.Fatal("want exactly one message after half a second")
+	}
+
+	// A long pause refills to the burst, no further
+	now = now.Add(time.Minute)
+	for i := range 3 {
+		if !l.allow(now) {
+			t.Fatalf("message %d after refilling was refused", i)
+		}
+	}
+	if l.allow(now) {
+		t.Fatal("refill exceeded the burst")
+	}
+}
+
+func TestRateLimiterDropWindow(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	now := time.Now()
+
+	for want := 1; want <= 3; want++ {
+		if got := l.recordDrop(now); got != want {
+			t.Fatalf("recordDrop = %d, want %d", got, want)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// Drops more than rateLimitWindow apart start a new count
+	if got := l.recordDrop(now.Add(rateLimitWindow)); got != 1 {
+		t.Fatalf("recordDrop after the window = %d, want 1", got)
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	if l := newRateLimiter(0, 10); l != nil {
+		t.Fatal("zero rate should disable the limiter")
+	}
+	if l := newRateLimiter(5, 0); l == nil || l.burst != 1 {
+		t.Fatalf("burst below one should become one, got %+v", l)
+	}
+}
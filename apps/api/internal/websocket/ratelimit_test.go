@@ -0,0 +1,44 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+func TestFloodingClientIsEvictedAsRateLimited(t *testing.T) {
+	evicted := make(chan string, 1)
+	hub, srv := startHub(t, ws.Config{
+		InboundRateLimit:         1,
+		InboundBurst:             1,
+		InboundRateLimitMaxDrops: 3,
+	}, func(hub *ws.Hub) {
+		hub.OnClientEvicted(func(c *ws.Client, reason string) { evicted <- reason })
+	})
+	client := dial(t, srv, "flood")
+
+	// One message within the burst, then three drops
+	for range 4 {
+		if err := client.Send("noise", nil); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	select {
+	case reason := <-evicted:
+		if reason != ws.EvictRateLimited {
+			t.Fatalf("eviction reason = %q, want %q", reason, ws.EvictRateLimited)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flooding client was never evicted")
+	}
+	if n := hub.Stats().ClientsEvictedRateLimit; n != 1 {
+		t.Fatalf("ClientsEvictedRateLimit = %d, want 1", n)
+	}
+	if _, err := client.Next(time.Second); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("Next error = %v, want a policy-violation close", err)
+	}
+}
@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"context"
+	"slices"
+)
+
+// Number of messages BroadcastWhenReady holds while no client is connected
+const heldMessageLimit = 32
+
+// heldMessage is a BroadcastWhenReady message waiting for a first client
+type heldMessage struct {
+	ctx     context.Context
+	message Message
+}
+
+// BroadcastWhenReady sends a message to all connected clients, or, if none
+// are connected, holds it until the next client connects or ctx is done
+// Under Config.RequireHello only clients that have said hello count, and the
+// message waits for the next hello
+// This covers startup races where a producer fires before the UI connects
+// At most heldMessageLimit messages are held; beyond that the oldest is
+// dropped and counted in Stats.HeldMessagesDropped
+// Returns ctx's error if it is already done, or as BroadcastMessage
+func (h *Hub) BroadcastWhenReady(ctx context.Context, eventType string, data interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := h.validate(eventType, data); err != nil {
+		return err
+	}
+
+	// Checked under heldMu so a client becoming ready now either is counted
+	// here or releases the message once it has been added
+	h.heldMu.Lock()
+	if h.hasReadyClient() {
+		h.heldMu.Unlock()
+		return h.BroadcastMessage(eventType, data)
+	}
+	defer h.heldMu.Unlock()
+
+	h.held = slices.DeleteFunc(h.held, func(m heldMessage) bool { return m.ctx.Err() != nil })
+	if len(h.held) >= heldMessageLimit {
+		h.held = slices.Delete(h.held, 0, 1)
+		h.counters.heldDropped.Add(1)
+		h.logger.Warn("WebSocket held message queue full, dropping oldest message")
+	}
+	h.held = append(h.held, heldMessage{ctx: ctx, message: Message{Type: eventType, Data: data}})
+	return nil
+}
+
+// hasReadyClient reports whether any connected client is receiving messages
+func (h *Hub) hasReadyClient() bool {
+	if h.clientCount.Load() == 0 {
+		return false
+	}
+	if !h.config.RequireHello {
+		return true
+	}
+	for _, client := range h.snapshot() {
+		if client.Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseHeld broadcasts the messages held by BroadcastWhenReady whose
+// contexts are still live; called from the hub loop once a client is ready
+func (h *Hub) releaseHeld() {
+	h.heldMu.Lock()
+	held := h.held
+	h.held = nil
+	h.heldMu.Unlock()
+
+	for _, m := range held {
+		if m.ctx.Err() != nil {
+			continue
+		}
+		// Never block the hub loop on its own broadcast channel
+		ok, err := h.publish(m.ctx, m.message, broadcastRequest{neverBlock: true})
+		if err != nil {
+			h.logger.Error("Error marshaling held WebSocket message", "type", m.message.Type, "error", err)
+		} else if !ok {
+			h.logger.Warn("WebSocket broadcast channel full, dropping held message", "type", m.message.Type)
+		}
+	}
+}
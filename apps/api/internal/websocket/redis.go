@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisChannel is the pub/sub channel used when none is given
+const DefaultRedisChannel = "nous:websocket:broadcast"
+
+// RedisBackplane is a Backplane built on Redis pub/sub
+type RedisBackplane struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedisBackplane creates a backplane publishing on the given Redis channel
+// An empty channel uses DefaultRedisChannel
+func NewRedisBackplane(client *redis.Client, channel string) *RedisBackplane {
+	if channel == "" {
+		channel = DefaultRedisChannel
+	}
+	return &RedisBackplane{client: client, channel: channel}
+}
+
+// Publish sends payload to every hub subscribed to the channel
+func (b *RedisBackplane) Publish(ctx context.Context, payload []byte) error {
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+// Subscribe delivers messages published on the channel until ctx is done
+func (b *RedisBackplane) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	// Wait for confirmation so connection errors are reported to the caller
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return redis.ErrClosed
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
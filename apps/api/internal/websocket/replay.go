@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// resumeMessageType is sent by a reconnecting client to request missed broadcasts
+const resumeMessageType = "resume"
+
+// resumeData is the payload of a resume message
+type resumeData struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// replayEntry is a broadcast kept for replay, with its sequence number and
+// its position in fan-out order
+type replayEntry struct {
+	seq     uint64
+	pos     uint64
+	message outbound
+}
+
+// replayBuffer is a fixed-size ring of the most recent broadcasts
+type replayBuffer struct {
+	mu      sync.Mutex
+	entries []replayEntry
+	next    int
+	full    bool
+
+	// Number of broadcasts ever added; sequence numbers can arrive out of
+	// order (see Hub.seqMu), so replay cuts off by position instead
+	count uint64
+}
+
+// newReplayBuffer returns a ring holding size broadcasts, or nil when size is zero
+func newReplayBuffer(size int) *replayBuffer {
+	if size <= 0 {
+		return nil
+	}
+	return &replayBuffer{entries: make([]replayEntry, size)}
+}
+
+// add records a broadcast, overwriting the oldest entry once the ring is full
+func (b *replayBuffer) add(seq uint64, message outbound) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.count++
+	b.entries[b.next] = replayEntry{seq: seq, pos: b.count, message: message}
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// added returns the number of broadcasts added so far
+func (b *replayBuffer) added() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.count
+}
+
+// missed returns the buffered broadcasts with a sequence number above after
+// that were among the first upto added, oldest first
+func (b *replayBuffer) missed(after, upto uint64) []outbound {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, n := 0, b.next
+	if b.full {
+		start, n = b.next, len(b.entries)
+	}
+
+	var messages []outbound
+	for i := 0; i < n; i++ {
+		entry := b.entries[(start+i)%len(b.entries)]
+		if entry.seq > after && entry.pos <= upto {
+			messages = append(messages, entry.message)
+		}
+	}
+	return messages
+}
+
+// joined records where live delivery to a client starts; called from the hub
+// loop once the client is ready
+func (h *Hub) joined(c *Client) {
+	if h.replay != nil {
+		c.joinedAt = h.replay.added()
+	}
+}
+
+// resumeRequest asks the hub loop to replay broadcasts a client missed
+type resumeRequest struct {
+	client  *Client
+	lastSeq uint64
+}
+
+// requestResume hands a resume message to the hub loop
+// Returns false if the message is not a resume request the hub handles
+func (c *Client) requestResume(msg Message) bool {
+	if msg.Type != resumeMessageType || c.hub.replay == nil {
+		return false
+	}
+
+	var data resumeData
+	raw, _ := msg.Data.(json.RawMessage)
+	if err := json.Unmarshal(raw, &data); err != nil {
+		c.log.Warn("WebSocket client sent malformed resume request", "error", err)
+		return true
+	}
+
+	select {
+	case c.hub.resume <- resumeRequest{client: c, lastSeq: data.LastSeq}:
+	case <-c.hub.done:
+	}
+	return true
+}
+
+// replayTo delivers the buffered broadcasts a resuming client missed
+// Only messages fanned out before the client was ready are replayed, since
+// everything after that was already delivered live. Runs on the hub loop
+func (h *Hub) replayTo(req resumeRequest) {
+	missed := h.replay.missed(req.lastSeq, req.client.joinedAt)
+	for _, message := range missed {
+		if !h.deliver(req.client, message) {
+			break
+		}
+	}
+	req.client.log.Info("WebSocket client resumed", "last_seq", req.lastSeq, "replayed", len(missed))
+}
@@ -0,0 +1,24 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReplayBufferCutsOffByFanOutOrder(t *testing.T) {
+	b := newReplayBuffer(4)
+	// Seq 2 waited for room under BlockOnFull and was fanned out after 3
+	for _, seq := range []uint64{1, 3, 2} {
+		b.add(seq, textMessage([]byte{byte('0' + seq)}))
+	}
+	joined := b.added()
+	b.add(4, textMessage([]byte("4")))
+
+	var got []string
+	for _, message := range b.missed(0, joined) {
+		got = append(got, string(message.data))
+	}
+	if want := []string{"1", "3", "2"}; !slices.Equal(got, want) {
+		t.Fatalf("missed = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package websocket_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+	"github.com/yourorg/nous/internal/websocket/wstest"
+)
+
+// broadcastN sends n broadcasts, waiting for each to be fanned out
+func broadcastN(t *testing.T, hub *ws.Hub, n int) {
+	t.Helper()
+	for i := range n {
+		if _, err := hub.BroadcastMessageN("msg", i); err != nil {
+			t.Fatalf("BroadcastMessageN: %v", err)
+		}
+	}
+}
+
+// seqs reads n messages and returns their sequence numbers
+func seqs(t *testing.T, client *wstest.Client, n int) []uint64 {
+	t.Helper()
+	var got []uint64
+	for range n {
+		msg, err := client.Next(time.Second)
+		if err != nil {
+			t.Fatalf("Next after %v: %v", got, err)
+		}
+		got = append(got, msg.Seq)
+	}
+	return got
+}
+
+// expectNoMore fails the test if the client receives anything else
+// A read timeout breaks the connection, so this must come last
+func expectNoMore(t *testing.T, client *wstest.Client) {
+	t.Helper()
+	if msg, err := client.Next(50 * time.Millisecond); err == nil {
+		t.Fatalf("unexpected message %s", msg.Raw)
+	}
+}
+
+func TestResumeReplaysBroadcastsAfterLastSeq(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{ReplayBuffer: 8})
+	broadcastN(t, hub, 3)
+
+	client := dial(t, srv, "mobile")
+	if err := client.Send("resume", map[string]uint64{"last_seq": 1}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := seqs(t, client, 2); !slices.Equal(got, []uint64{2, 3}) {
+		t.Fatalf("replayed seqs = %v, want [2 3]", got)
+	}
+
+	broadcastN(t, hub, 1)
+	if got := seqs(t, client, 1); !slices.Equal(got, []uint64{4}) {
+		t.Fatalf("live seqs = %v, want [4]", got)
+	}
+	expectNoMore(t, client)
+}
+
+func TestResumeOlderThanBufferReplaysWhatIsKept(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{ReplayBuffer: 2})
+	broadcastN(t, hub, 5)
+
+	client := dial(t, srv, "mobile")
+	if err := client.Send("resume", map[string]uint64{"last_seq": 1}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// Seqs 2 and 3 fell out of the ring; the gap tells the client to resync
+	if got := seqs(t, client, 2); !slices.Equal(got, []uint64{4, 5}) {
+		t.Fatalf("replayed seqs = %v, want [4 5]", got)
+	}
+	expectNoMore(t, client)
+}
+
+func TestResumeDoesNotRepeatLiveBroadcasts(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{ReplayBuffer: 8})
+	broadcastN(t, hub, 2)
+
+	// Broadcasts between connecting and resuming are delivered live
+	client := dial(t, srv, "mobile")
+	broadcastN(t, hub, 2)
+	if got := seqs(t, client, 2); !slices.Equal(got, []uint64{3, 4}) {
+		t.Fatalf("live seqs = %v, want [3 4]", got)
+	}
+
+	// so only the ones sent before the client connected are replayed
+	if err := client.Send("resume", map[string]uint64{"last_seq": 0}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := seqs(t, client, 2); !slices.Equal(got, []uint64{1, 2}) {
+		t.Fatalf("replayed seqs = %v, want [1 2]", got)
+	}
+	expectNoMore(t, client)
+}
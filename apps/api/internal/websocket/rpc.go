@@ -0,0 +1,62 @@
+package websocket
+
+import "encoding/json"
+
+// Request/response messages: a client sends
+// {"type":"rpc","id":"abc","method":"getStatus","data":{...}} and receives
+// {"type":"rpc_result","id":"abc","data":{...}}
+const (
+	rpcMessageType = "rpc"
+	rpcResultType  = "rpc_result"
+)
+
+// RPCHandler serves one method of client rpc requests; id is the request's
+// correlation ID, to pass to Client.Reply, and params its raw data
+type RPCHandler func(c *Client, id string, params json.RawMessage)
+
+// HandleRPC registers the handler for rpc requests calling method,
+// replacing any earlier handler for it. Requests for methods with no handler
+// are routed like any other "rpc" message (Handle, then OnMessage), with the
+// Message's ID and Method set
+// Handlers run on the client's dispatch goroutine in the order requests
+// arrive, but may reply later from elsewhere; clients should match results
+// to requests by ID, as concurrent requests from one client can complete in
+// any order
+// Must be called before the hub starts serving connections
+func (h *Hub) HandleRPC(method string, handler RPCHandler) {
+	h.rpcHandlers[method] = handler
+}
+
+// handleRPC routes an rpc request to the handler for its method
+// Returns false if the message isn't an rpc request with a handler
+func (h *Hub) handleRPC(c *Client, msg Message) bool {
+	if msg.Type != rpcMessageType {
+		return false
+	}
+	handler, ok := h.rpcHandlers[msg.Method]
+	if !ok {
+		return false
+	}
+	params, _ := msg.Data.(json.RawMessage)
+	handler(c, msg.ID, params)
+	return true
+}
+
+// Reply sends the result of the rpc request with the given ID to the client
+// as {"type":"rpc_result","id":requestID,"data":data}
+// Returns ErrSendBufferFull if the result could not be queued
+func (c *Client) Reply(requestID string, data interface{}) error {
+	frame, err := c.hub.encode(Message{
+		Type: rpcResultType,
+		ID:   requestID,
+		Data: data,
+	})
+	if err != nil {
+		c.log.Error("Error marshaling WebSocket message", "type", rpcResultType, "error", err)
+		return err
+	}
+	if !c.hub.deliver(c, frame) {
+		return ErrSendBufferFull
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// Number of client shards; clients are spread across them by ID so
+// broadcasts, lookups and registrations in different shards don't contend
+const clientShards = 32
+
+// clientShard holds the registered clients whose IDs hash to it
+type clientShard struct {
+	mu      sync.RWMutex
+	clients map[*Client]bool
+
+	// Registered clients indexed by ID for targeted delivery
+	byID map[string]*Client
+
+	// IDs in use, from the start of the handshake until the client drops,
+	// so a second connection can't take over a connected client's ID
+	claimed map[string]bool
+}
+
+// shardSeed keys the hash that assigns client IDs to shards
+var shardSeed = maphash.MakeSeed()
+
+// newClientShards allocates n client shards
+func newClientShards(n int) []*clientShard {
+	shards := make([]*clientShard, n)
+	for i := range shards {
+		shards[i] = &clientShard{
+			clients: make(map[*Client]bool),
+			byID:    make(map[string]*Client),
+			claimed: make(map[string]bool),
+		}
+	}
+	return shards
+}
+
+// shardFor returns the shard a client ID belongs to
+func (h *Hub) shardFor(id string) *clientShard {
+	return h.shards[maphash.String(shardSeed, id)%uint64(len(h.shards))]
+}
+
+// addClient registers a client and returns the new number of clients
+func (h *Hub) addClient(c *Client) int {
+	shard := h.shardFor(c.id)
+	shard.mu.Lock()
+	shard.clients[c] = true
+	shard.byID[c.id] = c
+	shard.mu.Unlock()
+	h.indexUser(c)
+	return int(h.clientCount.Add(1))
+}
+
+// dropClient unregisters a client, releasing its connection slot
+// Returns false if it wasn't registered, along with the remaining number of clients
+func (h *Hub) dropClient(c *Client) (bool, int) {
+	shard := h.shardFor(c.id)
+	shard.mu.Lock()
+	_, ok := shard.clients[c]
+	if ok {
+		delete(shard.clients, c)
+		delete(shard.byID, c.id)
+		delete(shard.claimed, c.id)
+	}
+	shard.mu.Unlock()
+
+	if !ok {
+		return false, int(h.clientCount.Load())
+	}
+	h.unindexUser(c)
+	h.releaseSlot()
+	h.releaseIP(c.ip)
+	return true, int(h.clientCount.Add(-1))
+}
+
+// claimID reserves a client ID for a new connection
+// Returns false if a connected (or connecting) client already has it
+func (h *Hub) claimID(id string) bool {
+	shard := h.shardFor(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.claimed[id] {
+		return false
+	}
+	shard.claimed[id] = true
+	return true
+}
+
+// releaseID frees an ID claimed by a connection that was never registered
+func (h *Hub) releaseID(id string) {
+	shard := h.shardFor(id)
+	shard.mu.Lock()
+	delete(shard.claimed, id)
+	shard.mu.Unlock()
+}
+
+// lookup returns the registered client with the given ID
+func (h *Hub) lookup(id string) (*Client, bool) {
+	shard := h.shardFor(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	client, ok := shard.byID[id]
+	return client, ok
+}
+
+// registered reports whether c is currently registered
+func (h *Hub) registered(c *Client) bool {
+	shard := h.shardFor(c.id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.clients[c]
+}
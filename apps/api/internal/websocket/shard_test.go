@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// Benchmarks comparing the sharded registry with a single shard, which is
+// the single map and lock the hub used before. Background connects and
+// disconnects keep the registry's write locks busy, as under real load:
+//
+//	go test -run '^$' -bench 'SendToClient|BroadcastMessage' ./internal/websocket
+
+// benchShards are the registry layouts compared: one map, and the default
+var benchShards = []int{1, clientShards}
+
+// benchClients is how many connected clients each benchmark hub has
+const benchClients = 1000
+
+// benchHub runs a hub with the given number of shards and benchClients
+// registered clients whose send lanes are drained, returning their IDs
+func benchHub(b *testing.B, shards int) (*Hub, []string) {
+	b.Helper()
+	h, err := NewHubWithConfig(Config{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		b.Fatalf("NewHubWithConfig: %v", err)
+	}
+	h.shards = newClientShards(shards)
+	go h.Run()
+	b.Cleanup(h.Shutdown)
+
+	ids := make([]string, benchClients)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("client-%d", i)
+		c := benchClient(h, ids[i])
+		go func() {
+			for range c.send {
+			}
+		}()
+		h.addClient(c)
+	}
+	return h, ids
+}
+
+// benchClient returns a client with no connection behind it
+func benchClient(h *Hub, id string) *Client {
+	return &Client{
+		hub:      h,
+		id:       id,
+		send:     make(chan outbound, h.config.ClientSendBuffer),
+		sendHigh: make(chan outbound, h.config.HighPrioritySendBuffer),
+		log:      h.logger,
+	}
+}
+
+// churn registers and unregisters clients on workers goroutines until the
+// returned function is called. They never say hello, so nothing is sent to them
+func churn(h *Hub, workers int) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range workers {
+		c := benchClient(h, fmt.Sprintf("churn-%d", w))
+		c.awaitingHello.Store(true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				h.addClient(c)
+				h.dropClient(c)
+				// Don't starve the benchmark when there are fewer CPUs than workers
+				runtime.Gosched()
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func BenchmarkSendToClient(b *testing.B) {
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			h, ids := benchHub(b, shards)
+			defer churn(h, 4)()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					h.SendToClient(ids[i%len(ids)], "bench", nil)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkBroadcastMessage(b *testing.B) {
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			h, _ := benchHub(b, shards)
+			defer churn(h, 4)()
+
+			b.ResetTimer()
+			for range b.N {
+				// Waits for the fan-out, so each op covers every client
+				if _, err := h.BroadcastMessageN("bench", nil); err != nil {
+					b.Fatalf("BroadcastMessageN: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// highWaterWarnInterval is the minimum time between broadcast queue warnings
+const highWaterWarnInterval = 10 * time.Second
+
+// Stats is a point-in-time snapshot of hub activity
+type Stats struct {
+	ConnectedClients           int    `json:"connected_clients"`
+	PausedClients              int    `json:"paused_clients"`
+	MessagesBroadcast          uint64 `json:"messages_broadcast"`
+	MessagesDropped            uint64 `json:"messages_dropped"`
+	MessagesExpired            uint64 `json:"messages_expired"`
+	BroadcastBlockTimeouts     uint64 `json:"broadcast_block_timeouts"`
+	BatchesFlushed             uint64 `json:"batches_flushed"`
+	SlowClientsEvicted         uint64 `json:"slow_clients_evicted"`
+	ClientsEvictedFullBuffer   uint64 `json:"clients_evicted_full_buffer"`
+	ClientsEvictedWriteError   uint64 `json:"clients_evicted_write_error"`
+	ClientsKicked              uint64 `json:"clients_kicked"`
+	ClientsReplaced            uint64 `json:"clients_replaced"`
+	ClientsEvictedMessageSize  uint64 `json:"clients_evicted_message_size"`
+	ClientsEvictedRateLimit    uint64 `json:"clients_evicted_rate_limit"`
+	InboundRateLimited         uint64 `json:"inbound_rate_limited"`
+	AuditEventsDropped         uint64 `json:"audit_events_dropped"`
+	HeldMessagesDropped        uint64 `json:"held_messages_dropped"`
+	CurrentBroadcastQueueDepth int    `json:"current_broadcast_queue_depth"`
+
+	// Payload and on-the-wire bytes of compressed messages; CompressionRatio
+	// is out over in (zero until something has been compressed)
+	CompressionBytesIn  uint64  `json:"compression_bytes_in"`
+	CompressionBytesOut uint64  `json:"compression_bytes_out"`
+	CompressionRatio    float64 `json:"compression_ratio"`
+
+	// Over sampled batch flushes, the bytes the batches were sent in versus
+	// the bytes their events would have taken sent (and compressed) one by
+	// one; BatchCompressionRatio is the first over the second
+	BatchFrameBytes       uint64  `json:"batch_frame_bytes"`
+	BatchUnbatchedBytes   uint64  `json:"batch_unbatched_bytes"`
+	BatchCompressionRatio float64 `json:"batch_compression_ratio"`
+
+	// ClientsEvictedWriteError broken down by cause
+	WriteErrorsTimeout uint64 `json:"write_errors_timeout"`
+	WriteErrorsClosed  uint64 `json:"write_errors_closed"`
+	WriteErrorsOther   uint64 `json:"write_errors_other"`
+
+	// Messages (and their bytes) queued to clients versus actually written to
+	// their sockets; the gap is what was lost to eviction, disconnects and
+	// expiry, plus whatever is still buffered. Streams are excluded
+	MessagesQueued  uint64 `json:"messages_queued"`
+	MessagesWritten uint64 `json:"messages_written"`
+	BytesQueued     uint64 `json:"bytes_queued"`
+	BytesWritten    uint64 `json:"bytes_written"`
+
+	// Ping round-trip time percentiles across clients
+	Latency LatencyStats `json:"latency"`
+
+	// Time BroadcastMessageBatched events spent waiting for their flush
+	BatchLatency BatchLatencyStats `json:"batch_latency"`
+}
+
+// hubCounters holds the hub's monotonically increasing counters
+// Fields are updated atomically so Stats can be read concurrently with broadcasts
+type hubCounters struct {
+	messagesBroadcast atomic.Uint64
+	messagesDropped   atomic.Uint64
+	messagesExpired   atomic.Uint64
+	blockTimeouts     atomic.Uint64
+	batchesFlushed    atomic.Uint64
+
+	slowClientsEvicted   atomic.Uint64
+	evictedFullBuffer    atomic.Uint64
+	evictedWriteError    atomic.Uint64
+	writeErrorsTimeout   atomic.Uint64
+	writeErrorsClosed    atomic.Uint64
+	writeErrorsOther     atomic.Uint64
+	evictedMessageTooBig atomic.Uint64
+	evictedRateLimited   atomic.Uint64
+	kicked               atomic.Uint64
+	replaced             atomic.Uint64
+	inboundRateLimited   atomic.Uint64
+	auditDropped         atomic.Uint64
+	heldDropped          atomic.Uint64
+
+	compressionIn  atomic.Uint64
+	compressionOut atomic.Uint64
+
+	messagesQueued  atomic.Uint64
+	messagesWritten atomic.Uint64
+	bytesQueued     atomic.Uint64
+	bytesWritten    atomic.Uint64
+
+	batchFrameBytes     atomic.Uint64
+	batchUnbatchedBytes atomic.Uint64
+
+	// Batch waits in nanoseconds: their sum, count and the longest seen
+	batchWaitTotal atomic.Uint64
+	batchWaitCount atomic.Uint64
+	batchWaitMax   atomic.Uint64
+}
+
+// Stats returns a snapshot of the hub's counters and current state
+func (h *Hub) Stats() Stats {
+	return Stats{
+		ConnectedClients:           h.GetClientCount(),
+		PausedClients:              h.pausedClients(),
+		MessagesBroadcast:          h.counters.messagesBroadcast.Load(),
+		MessagesDropped:            h.counters.messagesDropped.Load(),
+		MessagesExpired:            h.counters.messagesExpired.Load(),
+		BroadcastBlockTimeouts:     h.counters.blockTimeouts.Load(),
+		BatchesFlushed:             h.counters.batchesFlushed.Load(),
+		SlowClientsEvicted:         h.counters.slowClientsEvicted.Load(),
+		ClientsEvictedFullBuffer:   h.counters.evictedFullBuffer.Load(),
+		ClientsEvictedWriteError:   h.counters.evictedWriteError.Load(),
+		WriteErrorsTimeout:         h.counters.writeErrorsTimeout.Load(),
+		WriteErrorsClosed:          h.counters.writeErrorsClosed.Load(),
+		WriteErrorsOther:           h.counters.writeErrorsOther.Load(),
+		ClientsKicked:              h.counters.kicked.Load(),
+		ClientsReplaced:            h.counters.replaced.Load(),
+		ClientsEvictedMessageSize:  h.counters.evictedMessageTooBig.Load(),
+		ClientsEvictedRateLimit:    h.counters.evictedRateLimited.Load(),
+		InboundRateLimited:         h.counters.inboundRateLimited.Load(),
+		AuditEventsDropped:         h.counters.auditDropped.Load(),
+		HeldMessagesDropped:        h.counters.heldDropped.Load(),
+		CurrentBroadcastQueueDepth: h.BroadcastQueueDepth(),
+		CompressionBytesIn:         h.counters.compressionIn.Load(),
+		CompressionBytesOut:        h.counters.compressionOut.Load(),
+		CompressionRatio:           h.compressionRatio(),
+		BatchFrameBytes:            h.counters.batchFrameBytes.Load(),
+		BatchUnbatchedBytes:        h.counters.batchUnbatchedBytes.Load(),
+		BatchCompressionRatio:      h.batchCompressionRatio(),
+		MessagesQueued:             h.counters.messagesQueued.Load(),
+		MessagesWritten:            h.counters.messagesWritten.Load(),
+		BytesQueued:                h.counters.bytesQueued.Load(),
+		BytesWritten:               h.counters.bytesWritten.Load(),
+		Latency:                    h.latencyStats(),
+		BatchLatency:               h.batchLatencyStats(),
+	}
+}
+
+// EventTypeCounts returns how many messages of each event type have been
+// broadcast, counting batched events individually rather than as batches
+func (h *Hub) EventTypeCounts() map[string]uint64 {
+	counts := make(map[string]uint64)
+	h.eventTypes.Range(func(eventType, count any) bool {
+		counts[eventType.(string)] = count.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// countEventType adds n broadcasts of eventType to EventTypeCounts
+// A sync.Map keeps the common case, an already seen type, lock-free
+func (h *Hub) countEventType(eventType string, n int) {
+	count, ok := h.eventTypes.Load(eventType)
+	if !ok {
+		count, _ = h.eventTypes.LoadOrStore(eventType, new(atomic.Uint64))
+	}
+	count.(*atomic.Uint64).Add(uint64(n))
+}
+
+// countQueued counts a message queued to a client
+func (h *Hub) countQueued(message outbound) {
+	if message.stream != nil {
+		return
+	}
+	h.counters.messagesQueued.Add(1)
+	h.counters.bytesQueued.Add(uint64(len(message.data)))
+}
+
+// countWritten counts messages written to a client's socket
+func (h *Hub) countWritten(messages, bytes int) {
+	h.counters.messagesWritten.Add(uint64(messages))
+	h.counters.bytesWritten.Add(uint64(bytes))
+}
+
+// BroadcastQueueDepth returns the number of broadcasts waiting to be fanned out
+func (h *Hub) BroadcastQueueDepth() int {
+	return len(h.broadcast)
+}
+
+// warnIfNearCapacity logs, at most once per highWaterWarnInterval, when the
+// broadcast queue is above Config.BroadcastHighWater percent of its capacity
+func (h *Hub) warnIfNearCapacity() {
+	if !h.nearCapacity() {
+		return
+	}
+	depth, capacity := len(h.broadcast), cap(h.broadcast)
+
+	now := time.Now().UnixNano()
+	last := h.lastHighWaterWarn.Load()
+	if now-last < int64(highWaterWarnInterval) || !h.lastHighWaterWarn.CompareAndSwap(last, now) {
+		return
+	}
+	h.logger.Warn("WebSocket broadcast queue near capacity", "depth", depth, "capacity", capacity)
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Message types of a stream sent with SendStream
+const (
+	streamChunkType = "chunk"
+	streamEndType   = "end"
+)
+
+// ErrSendBufferFull is returned when a client's send buffer cannot accept a message
+var ErrSendBufferFull = errors.New("websocket: client send buffer full")
+
+// streamChunk is the Data of a "chunk" message; Data is base64 in JSON
+type streamChunk struct {
+	StreamID  string `json:"stream_id"`
+	EventType string `json:"event_type"`
+	Index     int    `json:"index"`
+	Data      []byte `json:"data"`
+}
+
+// streamEnd is the Data of the "end" message closing a stream
+type streamEnd struct {
+	StreamID  string `json:"stream_id"`
+	EventType string `json:"event_type"`
+	Chunks    int    `json:"chunks"`
+
+	// Error is set when reading the source failed part way through
+	Error string `json:"error,omitempty"`
+}
+
+// outboundStream is a SendStream source queued for a client's writePump
+type outboundStream struct {
+	id        string
+	eventType string
+	r         io.Reader
+}
+
+// SendStream sends the contents of r to the client with the given ID as a
+// series of "chunk" messages followed by an "end" message, so large payloads
+// never have to be held in memory at once
+// Chunks are at most Config.StreamChunkSize bytes and numbered from zero; all
+// of them share a stream_id. The stream is queued like any other message and
+// written by the client's writePump, so nothing else is sent to the client
+// until it ends; a slow reader holds up that client's other messages too
+// r is read on the writePump goroutine and, if it is an io.Closer, closed
+// once the stream is written, or dropped because the connection ended first
+// If SendStream returns an error, r is untouched
+// Returns ErrClientNotFound if no such client is connected, or
+// ErrSendBufferFull if its send buffer is full
+func (h *Hub) SendStream(clientID string, eventType string, r io.Reader) error {
+	client, ok := h.lookup(clientID)
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	message := outbound{
+		messageType: websocket.TextMessage,
+		stream: &outboundStream{
+			id:        uuid.NewString(),
+			eventType: eventType,
+			r:         r,
+		},
+	}
+	if !h.deliver(client, message) {
+		return ErrSendBufferFull
+	}
+	return nil
+}
+
+// writeStream reads stream in chunks, writing each as its own message and
+// finishing with the end marker
+func (c *Client) writeStream(stream *outboundStream) error {
+	if closer, ok := stream.r.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	buf := make([]byte, c.hub.config.StreamChunkSize)
+	end := streamEnd{StreamID: stream.id, EventType: stream.eventType}
+	for {
+		n, err := io.ReadFull(stream.r, buf)
+		if n > 0 {
+			chunk := Message{Type: streamChunkType, Data: streamChunk{
+				StreamID:  stream.id,
+				EventType: stream.eventType,
+				Index:     end.Chunks,
+				Data:      buf[:n],
+			}}
+			if err := c.writeStreamMessage(chunk); err != nil {
+				return err
+			}
+			end.Chunks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			c.log.Warn("Error reading WebSocket stream source", "stream_id", stream.id, "error", err)
+			end.Error = err.Error()
+			break
+		}
+	}
+	return c.writeStreamMessage(Message{Type: streamEndType, Data: end})
+}
+
+// writeStreamMessage encodes and writes a single stream message
+func (c *Client) writeStreamMessage(message Message) error {
+	frame, err := c.hub.encode(message)
+	if err != nil {
+		return err
+	}
+	if err := c.setWriteDeadline(); err != nil {
+		return err
+	}
+	compressed, written := c.startWrite(frame)
+	if err := c.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+		return err
+	}
+	c.finishWrite(compressed, len(frame.data), written)
+	c.touch()
+	return nil
+}
@@ -0,0 +1,77 @@
+package websocket_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// blockingSource is a stream source whose reads wait for release
+type blockingSource struct {
+	reading   chan struct{}
+	release   chan struct{}
+	closed    chan struct{}
+	startOnce sync.Once
+}
+
+func newBlockingSource() *blockingSource {
+	return &blockingSource{
+		reading: make(chan struct{}),
+		release: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (s *blockingSource) Read(p []byte) (int, error) {
+	s.startOnce.Do(func() { close(s.reading) })
+	<-s.release
+	return len(p), nil
+}
+
+func (s *blockingSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+// closeSource is a stream source that reports being closed
+type closeSource struct {
+	*strings.Reader
+	closed chan struct{}
+}
+
+func (s closeSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestSendStreamClosesSourcesOfUnsentStreams(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{})
+	client := dial(t, srv, "streamer")
+
+	writing := newBlockingSource()
+	if err := hub.SendStream("streamer", "file", writing); err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	<-writing.reading
+
+	queued := closeSource{Reader: strings.NewReader("never sent"), closed: make(chan struct{})}
+	if err := hub.SendStream("streamer", "file", queued); err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+
+	// The next chunk's write fails once the client has gone
+	client.Close()
+	waitFor(t, "the client to disconnect", func() bool { return hub.GetClientCount() == 0 })
+	close(writing.release)
+
+	for name, closed := range map[string]chan struct{}{"writing": writing.closed, "queued": queued.closed} {
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatalf("%s stream source was never closed", name)
+		}
+	}
+}
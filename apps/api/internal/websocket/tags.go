@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+const (
+	// tagQueryPrefix marks query parameters that set tags at connect time,
+	// e.g. ?tag.region=us-east
+	tagQueryPrefix = "tag."
+
+	// setTagMessageType is sent by a client to set one of its own tags
+	setTagMessageType = "set_tag"
+)
+
+// setTagData is the payload of a set_tag message
+type setTagData struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// SetTag sets a tag on the client, replacing any previous value for key
+// An empty value removes the tag. Keys set this way belong to the server
+// from then on: set_tag messages from the client can no longer change them
+func (c *Client) SetTag(key, value string) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+
+	if c.serverTags == nil {
+		c.serverTags = make(map[string]bool)
+	}
+	c.serverTags[key] = true
+	c.putTag(key, value)
+}
+
+// setClientTag sets a tag on behalf of the client itself
+// Returns false, leaving the tag alone, if the server has set key
+func (c *Client) setClientTag(key, value string) bool {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+
+	if c.serverTags[key] {
+		return false
+	}
+	c.putTag(key, value)
+	return true
+}
+
+// putTag stores or removes a tag; tagsMu must be held
+func (c *Client) putTag(key, value string) {
+	if value == "" {
+		delete(c.tags, key)
+		return
+	}
+	c.tags[key] = value
+}
+
+// Tags returns a copy of the client's tags
+func (c *Client) Tags() map[string]string {
+	c.tagsMu.RLock()
+	defer c.tagsMu.RUnlock()
+
+	return maps.Clone(c.tags)
+}
+
+// HasTag reports whether the client's tag key is set to value
+func (c *Client) HasTag(key, value string) bool {
+	c.tagsMu.RLock()
+	defer c.tagsMu.RUnlock()
+
+	v, ok := c.tags[key]
+	return ok && v == value
+}
+
+// tagsFromRequest reads connect-time tags from tag.<key>=<value> query parameters
+func tagsFromRequest(r *http.Request) map[string]string {
+	tags := make(map[string]string)
+	for param, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(param, tagQueryPrefix)
+		if !ok || key == "" || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		tags[key] = values[0]
+	}
+	return tags
+}
+
+// requestSetTag applies a set_tag message from the client
+// Returns false if the message is not a set_tag request
+func (c *Client) requestSetTag(msg Message) bool {
+	if msg.Type != setTagMessageType {
+		return false
+	}
+
+	var data setTagData
+	raw, _ := msg.Data.(json.RawMessage)
+	if err := json.Unmarshal(raw, &data); err != nil || data.Key == "" {
+		c.log.Warn("WebSocket client sent malformed set_tag request", "error", err)
+		return true
+	}
+	if !c.setClientTag(data.Key, data.Value) {
+		c.log.Warn("WebSocket client tried to change a server-set tag", "key", data.Key)
+	}
+	return true
+}
+
+// BroadcastToTag sends a message to every client whose tag key equals value
+// Tags from query parameters and set_tag messages are chosen by the client, so
+// authorization-sensitive tags should be set with SetTag in OnConnect, which
+// also stops the client changing them later; setting an empty value there
+// clears a tag the client sent in the query and keeps it cleared
+func (h *Hub) BroadcastToTag(key, value, eventType string, data interface{}) {
+	h.BroadcastFunc(func(c *Client) bool {
+		return c.HasTag(key, value)
+	}, eventType, data)
+}
@@ -0,0 +1,51 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// tagsOf returns the tags of the connected client with the given ID
+func tagsOf(hub *ws.Hub, id string) map[string]string {
+	for _, info := range hub.Clients() {
+		if info.ID == id {
+			return info.Tags
+		}
+	}
+	return nil
+}
+
+func TestClientCannotOverrideServerTag(t *testing.T) {
+	connected := make(chan struct{})
+	hub, srv := startHub(t, ws.Config{}, func(hub *ws.Hub) {
+		hub.OnConnect(func(c *ws.Client) {
+			c.SetTag("role", "user")
+			close(connected)
+		})
+	})
+	client := dial(t, srv, "mallory")
+	<-connected
+
+	if err := client.Send("set_tag", map[string]string{"key": "role", "value": "admin"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := client.Send("set_tag", map[string]string{"key": "region", "value": "eu"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// Control messages are handled in order, so once region is set the role
+	// request has been handled too
+	waitFor(t, "the region tag", func() bool { return tagsOf(hub, "mallory")["region"] == "eu" })
+	if role := tagsOf(hub, "mallory")["role"]; role != "user" {
+		t.Fatalf("role tag = %q, want the server-set %q", role, "user")
+	}
+
+	hub.BroadcastToTag("role", "admin", "secret", nil)
+	hub.BroadcastToTag("role", "user", "routine", nil)
+	msg, err := client.Next(time.Second)
+	if err != nil || msg.Type != "routine" {
+		t.Fatalf("Next = %+v, %v; want only the broadcast to role=user", msg, err)
+	}
+}
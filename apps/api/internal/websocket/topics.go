@@ -0,0 +1,169 @@
+package websocket
+
+import "slices"
+
+// Subscribe adds a client to a topic so it receives BroadcastToTopic messages
+// topic may be a pattern: segments are separated by dots, * matches any one
+// segment and # any number of segments (including none), so agent.123.*
+// receives agent.123.logs and agent.# receives everything under agent
+// Subscribing a client that is no longer registered is a no-op
+func (h *Hub) Subscribe(c *Client, topic string) {
+	h.SubscribeWithSnapshot(c, topic, nil)
+}
+
+// SnapshotFunc returns the current state of a topic for a new subscriber,
+// or false if there is nothing to send
+type SnapshotFunc func(topic string) (Message, bool)
+
+// SubscribeWithSnapshot subscribes a client to a topic like Subscribe, first
+// queueing the message returned by snapshot so the client has the current
+// state before any of the topic's live messages
+// snapshot runs with the topic lock held, so it must not call back into the
+// hub's topic methods. A snapshot that doesn't fit in the client's send
+// buffer is dropped; the subscription still happens
+func (h *Hub) SubscribeWithSnapshot(c *Client, topic string, snapshot SnapshotFunc) {
+	if h.addSubscription(c, topic, snapshot) {
+		h.announceTopics(c, PresenceJoin, []string{topic})
+	}
+}
+
+// addSubscription records a subscription, returning false if nothing changed
+// The snapshot, if any, is queued before the client joins the delivery set
+func (h *Hub) addSubscription(c *Client, topic string, snapshot SnapshotFunc) bool {
+	h.topicsMu.Lock()
+	defer h.topicsMu.Unlock()
+
+	// Check registration under topicsMu so a concurrent removeClient
+	// either sees this subscription or we see the client as gone
+	if !h.registered(c) || c.topics[topic] {
+		return false
+	}
+
+	if snapshot != nil {
+		h.queueSnapshot(c, topic, snapshot)
+	}
+	h.topics.add(topic, c)
+	c.topics[topic] = true
+	return true
+}
+
+// queueSnapshot queues a topic snapshot for c without evicting it if full,
+// since eviction would need the topic lock the caller holds
+func (h *Hub) queueSnapshot(c *Client, topic string, snapshot SnapshotFunc) {
+	message, ok := snapshot(topic)
+	if !ok {
+		return
+	}
+	frame, err := h.encode(message)
+	if err != nil {
+		h.logger.Error("Error marshaling WebSocket topic snapshot", "type", message.Type, "topic", topic, "error", err)
+		return
+	}
+	if c.queue(frame) == queueFull {
+		c.log.Warn("WebSocket client send buffer full, dropping topic snapshot", "topic", topic)
+	}
+}
+
+// Unsubscribe removes a client from a topic, given as it was subscribed
+func (h *Hub) Unsubscribe(c *Client, topic string) {
+	h.topicsMu.Lock()
+	subscribed := c.topics[topic]
+	h.removeSubscription(c, topic)
+	h.topicsMu.Unlock()
+
+	if subscribed {
+		h.announceTopics(c, PresenceLeave, []string{topic})
+	}
+}
+
+// unsubscribeAll removes a client from every topic it joined
+// Returns the topics the client was subscribed to
+func (h *Hub) unsubscribeAll(c *Client) []string {
+	h.topicsMu.Lock()
+	defer h.topicsMu.Unlock()
+
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+		h.removeSubscription(c, topic)
+	}
+	return topics
+}
+
+// removeSubscription drops a single subscription and prunes empty topics
+// Must be called with topicsMu held
+func (h *Hub) removeSubscription(c *Client, topic string) {
+	if c.topics[topic] {
+		h.topics.remove(topic, c)
+	}
+	delete(c.topics, topic)
+}
+
+// topicSubscriberCount returns the number of clients subscribed to exactly
+// topic, not counting wildcard patterns that match it
+func (h *Hub) topicSubscriberCount(topic string) int {
+	h.topicsMu.RLock()
+	defer h.topicsMu.RUnlock()
+	return h.topics.count(topic)
+}
+
+// BroadcastToTopic sends a message to every client subscribed to the topic or
+// to a pattern matching it; a client matching several patterns gets it once
+// Clients whose send channel is full are disconnected, as with BroadcastMessage
+func (h *Hub) BroadcastToTopic(topic, eventType string, data interface{}) {
+	h.topicsMu.RLock()
+	subscribers := h.topics.match(topic)
+	h.topicsMu.RUnlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data}, "topic", topic)
+	if err != nil {
+		return
+	}
+
+	for _, client := range subscribers {
+		h.broadcastTo(client, frame)
+	}
+}
+
+// TopicStats returns the number of subscribers of every topic (or pattern)
+// that has any; wildcard subscribers aren't counted under the topics they match
+func (h *Hub) TopicStats() map[string]int {
+	h.topicsMu.RLock()
+	defer h.topicsMu.RUnlock()
+
+	stats := make(map[string]int)
+	h.topics.each(nil, func(topic string, subscribers int) {
+		stats[topic] = subscribers
+	})
+	return stats
+}
+
+// Topics returns every topic (or pattern) with at least one subscriber, sorted
+func (h *Hub) Topics() []string {
+	h.topicsMu.RLock()
+	defer h.topicsMu.RUnlock()
+
+	var topics []string
+	h.topics.each(nil, func(topic string, _ int) {
+		topics = append(topics, topic)
+	})
+	slices.Sort(topics)
+	return topics
+}
+
+// Topics returns the topics the client is subscribed to, sorted
+func (c *Client) Topics() []string {
+	c.hub.topicsMu.RLock()
+	defer c.hub.topicsMu.RUnlock()
+
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	return topics
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import "strings"
+
+// Topic pattern syntax: topics are dot-separated segments, e.g. agent.123.logs
+const (
+	topicSeparator = "."
+
+	// topicWildcard matches exactly one segment: agent.*.logs
+	topicWildcard = "*"
+
+	// topicMultiWildcard matches zero or more segments: agent.123.#
+	topicMultiWildcard = "#"
+)
+
+// topicNode is one segment of the subscription tree
+// Each subscribed pattern ends at a node holding its subscribers, so
+// publishing walks only the branches that can match instead of every pattern
+type topicNode struct {
+	children    map[string]*topicNode
+	subscribers map[*Client]bool
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{children: make(map[string]*topicNode)}
+}
+
+// add subscribes c to pattern
+func (n *topicNode) add(pattern string, c *Client) {
+	node := n
+	for _, segment := range strings.Split(pattern, topicSeparator) {
+		child, ok := node.children[segment]
+		if !ok {
+			child = newTopicNode()
+			node.children[segment] = child
+		}
+		node = child
+	}
+	if node.subscribers == nil {
+		node.subscribers = make(map[*Client]bool)
+	}
+	node.subscribers[c] = true
+}
+
+// remove unsubscribes c from pattern, pruning branches left empty
+func (n *topicNode) remove(pattern string, c *Client) {
+	n.removeSegments(strings.Split(pattern, topicSeparator), c)
+}
+
+func (n *topicNode) removeSegments(segments []string, c *Client) {
+	if len(segments) == 0 {
+		delete(n.subscribers, c)
+		return
+	}
+	child, ok := n.children[segments[0]]
+	if !ok {
+		return
+	}
+	child.removeSegments(segments[1:], c)
+	if len(child.subscribers) == 0 && len(child.children) == 0 {
+		delete(n.children, segments[0])
+	}
+}
+
+// count returns the number of clients subscribed to exactly pattern
+func (n *topicNode) count(pattern string) int {
+	node := n
+	for _, segment := range strings.Split(pattern, topicSeparator) {
+		if node = node.children[segment]; node == nil {
+			return 0
+		}
+	}
+	return len(node.subscribers)
+}
+
+// match returns every client with a pattern matching topic, each once
+func (n *topicNode) match(topic string) []*Client {
+	matched := make(map[*Client]bool)
+	n.collect(strings.Split(topic, topicSeparator), matched)
+
+	clients := make([]*Client, 0, len(matched))
+	for client := range matched {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func (n *topicNode) collect(segments []string, matched map[*Client]bool) {
+	// # also matches zero segments, so it applies wherever we are in the topic
+	if multi, ok := n.children[topicMultiWildcard]; ok {
+		for i := 0; i <= len(segments); i++ {
+			multi.collect(segments[i:], matched)
+		}
+	}
+	if len(segments) == 0 {
+		for client := range n.subscribers {
+			matched[client] = true
+		}
+		return
+	}
+	if child, ok := n.children[segments[0]]; ok {
+		child.collect(segments[1:], matched)
+	}
+	if segments[0] != topicWildcard {
+		if child, ok := n.children[topicWildcard]; ok {
+			child.collect(segments[1:], matched)
+		}
+	}
+}
+
+// each calls fn with every subscribed pattern under n and its subscriber count
+// path holds the segments leading to n
+func (n *topicNode) each(path []string, fn func(pattern string, subscribers int)) {
+	if len(n.subscribers) > 0 {
+		fn(strings.Join(path, topicSeparator), len(n.subscribers))
+	}
+	for segment, child := range n.children {
+		child.each(append(path, segment), fn)
+	}
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTopicTreeMatch(t *testing.T) {
+	patterns := []string{
+		"agent.123.logs",
+		"agent.*.logs",
+		"agent.123.#",
+		"agent.#",
+		"#",
+		"agent.*",
+		"other.logs",
+	}
+	tree := newTopicNode()
+	clients := make(map[*Client]string)
+	for _, pattern := range patterns {
+		c := &Client{id: pattern}
+		clients[c] = pattern
+		tree.add(pattern, c)
+	}
+
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		{"agent.123.logs", []string{"agent.123.logs", "agent.*.logs", "agent.123.#", "agent.#", "#"}},
+		{"agent.456.logs", []string{"agent.*.logs", "agent.#", "#"}},
+		{"agent.123", []string{"agent.123.#", "agent.#", "#", "agent.*"}},
+		{"agent.123.logs.errors", []string{"agent.123.#", "agent.#", "#"}},
+		{"agent", []string{"agent.#", "#"}},
+		{"other.logs", []string{"other.logs", "#"}},
+		{"other.status", []string{"#"}},
+	}
+	for _, tt := range tests {
+		got := make(map[string]bool)
+		for _, c := range tree.match(tt.topic) {
+			if got[clients[c]] {
+				t.Errorf("%s: %s matched twice", tt.topic, clients[c])
+			}
+			got[clients[c]] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s matched %v, want %v", tt.topic, got, tt.want)
+			continue
+		}
+		for _, pattern := range tt.want {
+			if !got[pattern] {
+				t.Errorf("%s: %s did not match", tt.topic, pattern)
+			}
+		}
+	}
+}
+
+func TestTopicTreeRemovePrunesEmptyBranches(t *testing.T) {
+	tree := newTopicNode()
+	a, b := &Client{id: "a"}, &Client{id: "b"}
+	tree.add("agent.123.logs", a)
+	tree.add("agent.123.logs", b)
+	tree.add("agent.*.status", a)
+
+	tree.remove("agent.123.logs", a)
+	if n := tree.count("agent.123.logs"); n != 1 {
+		t.Fatalf("count after removing one subscriber = %d, want 1", n)
+	}
+
+	tree.remove("agent.123.logs", b)
+	tree.remove("agent.*.status", a)
+	if len(tree.children) != 0 {
+		var left []string
+		tree.each(nil, func(pattern string, _ int) { left = append(left, pattern) })
+		t.Fatalf("tree not pruned: %d children, patterns %s", len(tree.children), strings.Join(left, ", "))
+	}
+	if got := tree.match("agent.123.logs"); len(got) != 0 {
+		t.Fatalf("match after removing everything = %d clients", len(got))
+	}
+}
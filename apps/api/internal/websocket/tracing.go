@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the hub's spans
+const tracerName = "github.com/yourorg/nous/internal/websocket"
+
+// traceContext carries span context in Message.Trace using W3C headers
+var traceContext = propagation.TraceContext{}
+
+// startSpan starts a span for message, continuing the trace carried in
+// message.Trace when present, and records the new span context there so
+// clients and other hubs can continue it. With the default no-op tracer the
+// span context is invalid and the message is left untouched
+func (h *Hub) startSpan(ctx context.Context, name string, message *Message, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if len(message.Trace) > 0 {
+		ctx = traceContext.Extract(ctx, propagation.MapCarrier(message.Trace))
+	}
+
+	attrs = append(attrs, attribute.String("websocket.message_type", message.Type))
+	ctx, span := h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+
+	if span.SpanContext().IsValid() {
+		carrier := propagation.MapCarrier{}
+		traceContext.Inject(ctx, carrier)
+		message.Trace = carrier
+	}
+	return ctx, span
+}
+
+// spanError marks span as failed with err
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// spanDropped adds a drop event to span
+func spanDropped(span trace.Span, reason string, attrs ...attribute.KeyValue) {
+	attrs = append(attrs, attribute.String("websocket.drop_reason", reason))
+	span.AddEvent("websocket.dropped", trace.WithAttributes(attrs...))
+}
+
+// startFanOutSpan starts a span for delivering req to the hub's clients,
+// or returns nil when the broadcast isn't being traced
+func (h *Hub) startFanOutSpan(req broadcastRequest) trace.Span {
+	if !req.span.IsValid() {
+		return nil
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), req.span)
+	_, span := h.tracer.Start(ctx, "websocket.fan_out", trace.WithSpanKind(trace.SpanKindInternal))
+	return span
+}
@@ -0,0 +1,12 @@
+package websocket
+
+import "time"
+
+// BroadcastWithTTL sends a message to all connected clients that is only
+// worth delivering for ttl, e.g. high-rate telemetry. Clients whose buffer
+// holds it longer than that skip it rather than receive stale data; skipped
+// messages are counted in Stats.MessagesExpired
+// Otherwise behaves like BroadcastMessage
+func (h *Hub) BroadcastWithTTL(ttl time.Duration, eventType string, data interface{}) error {
+	return h.BroadcastWithOptions(BroadcastOptions{TTL: ttl}, eventType, data)
+}
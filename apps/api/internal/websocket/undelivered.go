@@ -0,0 +1,57 @@
+package websocket
+
+import "io"
+
+// OnUndelivered registers a callback that receives the messages still queued
+// for a client when its connection ends, e.g. because a write failed or the
+// client dropped, so they can be persisted or re-queued. Messages are passed
+// in the order they would have been written, starting with those in the
+// write that failed, which may have partly reached the client. Streams are
+// left out and their sources closed. On a clean close every queued message is written first and
+// the callback isn't called. It runs on the client's write goroutine
+// Must be called before the hub starts serving connections
+func (h *Hub) OnUndelivered(fn func(c *Client, msgs [][]byte)) {
+	h.onUndelivered = fn
+}
+
+// track records a message as part of the frame being written, when
+// OnUndelivered needs to know about it
+func (c *Client) track(data []byte) {
+	if c.hub.onUndelivered != nil {
+		c.inflight = append(c.inflight, data)
+	}
+}
+
+// reportUndelivered drains whatever is left in the client's lanes, closing
+// the sources of queued streams and handing the other messages to the
+// OnUndelivered callback. Called once writePump has stopped writing
+func (c *Client) reportUndelivered() {
+	msgs := c.inflight
+	for _, lane := range []chan outbound{c.sendHigh, c.send} {
+		for drained := false; !drained; {
+			select {
+			case message, ok := <-lane:
+				if !ok {
+					drained = true
+					break
+				}
+				if message.stream != nil {
+					if closer, ok := message.stream.r.(io.Closer); ok {
+						closer.Close()
+					}
+					continue
+				}
+				if c.hub.onUndelivered != nil {
+					msgs = append(msgs, message.data)
+				}
+			default:
+				drained = true
+			}
+		}
+	}
+
+	// inflight is only tracked when there is a callback
+	if len(msgs) > 0 {
+		c.hub.onUndelivered(c, msgs)
+	}
+}
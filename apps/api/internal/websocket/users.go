@@ -0,0 +1,56 @@
+package websocket
+
+// indexUser adds c to the connections of its authenticated user
+func (h *Hub) indexUser(c *Client) {
+	if c.userID == "" {
+		return
+	}
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+	conns, ok := h.users[c.userID]
+	if !ok {
+		conns = make(map[*Client]bool)
+		h.users[c.userID] = conns
+	}
+	conns[c] = true
+}
+
+// unindexUser removes c from its user's connections
+func (h *Hub) unindexUser(c *Client) {
+	if c.userID == "" {
+		return
+	}
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+	conns := h.users[c.userID]
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(h.users, c.userID)
+	}
+}
+
+// SendToUser sends a message to every connection of the given user, as
+// established by Config.Authenticator, e.g. all of a user's tabs and devices
+// Returns the number of connections it was queued for; zero if the user has
+// none or the message could not be encoded
+func (h *Hub) SendToUser(userID string, eventType string, data interface{}) (connections int) {
+	frame, err := h.encodeLogged(Message{Type: eventType, Data: data})
+	if err != nil {
+		return 0
+	}
+
+	h.usersMu.RLock()
+	targets := make([]*Client, 0, len(h.users[userID]))
+	for client := range h.users[userID] {
+		targets = append(targets, client)
+	}
+	h.usersMu.RUnlock()
+
+	// Deliver without holding the lock, as deliver may evict a slow client
+	for _, client := range targets {
+		if h.deliver(client, frame) {
+			connections++
+		}
+	}
+	return connections
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInvalidPayload is returned when a message's data fails the validator
+// registered for its type
+var ErrInvalidPayload = errors.New("websocket: invalid payload")
+
+// Validator checks the data of an outgoing message before it is encoded
+type Validator func(data interface{}) error
+
+// Validate registers the validator for outgoing messages of the given type,
+// replacing any earlier one. Messages that fail it are not sent, and the
+// broadcast or send returns an error wrapping ErrInvalidPayload
+// Types without a validator are sent unchecked
+// Must be called before broadcasting
+func (h *Hub) Validate(eventType string, validator Validator) {
+	h.validators[eventType] = validator
+}
+
+// ValidateAs requires the data of outgoing messages of the given type to be
+// of the same Go type as example, or a pointer to it
+// Must be called before broadcasting
+func (h *Hub) ValidateAs(eventType string, example interface{}) {
+	want := reflect.TypeOf(example)
+	h.Validate(eventType, func(data interface{}) error {
+		got := reflect.TypeOf(data)
+		if got == want || (got != nil && got.Kind() == reflect.Pointer && got.Elem() == want) {
+			return nil
+		}
+		return fmt.Errorf("got %v, want %v", got, want)
+	})
+}
+
+// validate runs the validator registered for eventType, if any
+func (h *Hub) validate(eventType string, data interface{}) error {
+	validator, ok := h.validators[eventType]
+	if !ok {
+		return nil
+	}
+	if err := validator(data); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidPayload, eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package websocket_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+type agentStatus struct {
+	State string `json:"state"`
+}
+
+func TestValidatorRejectsBadPayloads(t *testing.T) {
+	hub, srv := startHub(t, ws.Config{}, func(hub *ws.Hub) {
+		hub.ValidateAs("status", agentStatus{})
+		hub.Validate("progress", func(data interface{}) error {
+			if p, ok := data.(int); !ok || p < 0 || p > 100 {
+				return errors.New("want a percentage")
+			}
+			return nil
+		})
+	})
+	client := dial(t, srv, "ui")
+
+	invalid := []struct {
+		eventType string
+		data      interface{}
+	}{
+		{"status", map[string]string{"state": "running"}},
+		{"status", nil},
+		{"progress", 101},
+		{"progress", "half"},
+	}
+	for _, tt := range invalid {
+		if err := hub.BroadcastMessage(tt.eventType, tt.data); !errors.Is(err, ws.ErrInvalidPayload) {
+			t.Errorf("BroadcastMessage(%s, %v) = %v, want ErrInvalidPayload", tt.eventType, tt.data, err)
+		}
+		if err := hub.SendToClient("ui", tt.eventType, tt.data); !errors.Is(err, ws.ErrInvalidPayload) {
+			t.Errorf("SendToClient(%s, %v) = %v, want ErrInvalidPayload", tt.eventType, tt.data, err)
+		}
+	}
+
+	// Valid payloads, and types without a validator, go through
+	for _, send := range []func() error{
+		func() error { return hub.BroadcastMessage("status", agentStatus{State: "running"}) },
+		func() error { return hub.BroadcastMessage("status", &agentStatus{State: "idle"}) },
+		func() error { return hub.BroadcastMessage("progress", 50) },
+		func() error { return hub.BroadcastMessage("unchecked", "anything") },
+	} {
+		if err := send(); err != nil {
+			t.Fatalf("BroadcastMessage: %v", err)
+		}
+	}
+	for _, want := range []string{"status", "status", "progress", "unchecked"} {
+		msg, err := client.Next(time.Second)
+		if err != nil || msg.Type != want {
+			t.Fatalf("Next = %+v, %v; want %s (nothing invalid sent first)", msg, err, want)
+		}
+	}
+}
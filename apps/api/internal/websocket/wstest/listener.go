@@ -0,0 +1,156 @@
+package wstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pipeListener is a net.Listener whose connections are in-memory pipes
+type pipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// Accept waits for the next dialed connection
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns a placeholder address for the in-memory listener
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// DialContext connects to the listener, matching websocket.Dialer.NetDialContext
+func (l *pipeListener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- newBufferedConn(server):
+		return newBufferedConn(client), nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, errors.New("wstest: server closed")
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// bufferedConn drains its end of a net.Pipe into memory so the peer's writes
+// never block on a slow reader, like a socket's kernel buffer
+// Only the read side is buffered; writes and write deadlines go to the pipe
+type bufferedConn struct {
+	net.Conn
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	buf          bytes.Buffer
+	err          error
+	readDeadline time.Time
+	timer        *time.Timer
+}
+
+func newBufferedConn(conn net.Conn) *bufferedConn {
+	c := &bufferedConn{Conn: conn}
+	c.cond = sync.NewCond(&c.mu)
+	go c.drain()
+	return c
+}
+
+// drain copies everything the peer writes into the read buffer
+func (c *bufferedConn) drain() {
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := c.Conn.Read(chunk)
+
+		c.mu.Lock()
+		c.buf.Write(chunk[:n])
+		if err != nil {
+			c.err = err
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read returns buffered data, waiting for more until the read deadline
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.buf.Len() == 0 && c.err == nil {
+		if !c.readDeadline.IsZero() && !time.Now().Before(c.readDeadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+	return 0, c.err
+}
+
+// SetReadDeadline sets the deadline for Read, waking blocked readers when it passes
+func (c *bufferedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !t.IsZero() {
+		c.timer = time.AfterFunc(time.Until(t), func() {
+			c.mu.Lock()
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		})
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetDeadline sets both the read and write deadlines
+func (c *bufferedConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.SetReadDeadline(t)
+}
+
+// pipeAddr is the address of both ends of an in-memory connection
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
@@ -0,0 +1,160 @@
+// Package wstest serves a websocket.Hub over in-memory connections so code
+// that broadcasts through the hub can be tested without opening sockets
+//
+// The hub must be running (go hub.Run()) before clients connect:
+//
+//	srv := wstest.NewServer(hub)
+//	defer srv.Close()
+//	client, err := srv.Dial("client-1")
+//	hub.Subscribe(...)
+//	msg, err := client.Next(time.Second)
+package wstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	ws "github.com/yourorg/nous/internal/websocket"
+)
+
+// registerTimeout bounds how long Dial waits for the hub to register a client
+const registerTimeout = 2 * time.Second
+
+// Message is a message received by a test client
+type Message struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	ID        string          `json:"id,omitempty"`
+	BatchType string          `json:"batch_type,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+
+	// Raw is the message exactly as the hub encoded it
+	Raw []byte `json:"-"`
+}
+
+// Server serves a hub's WebSocket endpoint over in-memory connections
+type Server struct {
+	hub      *ws.Hub
+	listener *pipeListener
+	server   *http.Server
+}
+
+// NewServer starts serving hub.ServeWS in memory
+func NewServer(hub *ws.Hub) *Server {
+	s := &Server{
+		hub:      hub,
+		listener: newPipeListener(),
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(hub.ServeWS)}
+	go s.server.Serve(s.listener)
+	return s
+}
+
+// Close stops the server; it does not shut down the hub
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// Dial connects a client with the given ID (random if empty) and waits until
+// the hub has registered it, so later broadcasts are guaranteed to reach it
+func (s *Server) Dial(clientID string) (*Client, error) {
+	return s.DialHeader(clientID, nil)
+}
+
+// DialHeader is like Dial but sends extra handshake headers, e.g. for an Authenticator
+func (s *Server) DialHeader(clientID string, header http.Header) (*Client, error) {
+	if clientID == "" {
+		clientID = uuid.NewString()
+	}
+
+	dialer := websocket.Dialer{
+		NetDialContext:   s.listener.DialContext,
+		HandshakeTimeout: registerTimeout,
+	}
+	conn, resp, err := dialer.Dial("ws://wstest/ws?client_id="+clientID, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("wstest: dial: %w (status %d)", err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("wstest: dial: %w", err)
+	}
+
+	if err := s.waitRegistered(clientID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Client{ID: clientID, conn: conn}, nil
+}
+
+// waitRegistered polls the hub until a client with the given ID is connected
+func (s *Server) waitRegistered(clientID string) error {
+	deadline := time.Now().Add(registerTimeout)
+	for time.Now().Before(deadline) {
+		registered := slices.ContainsFunc(s.hub.Clients(), func(info ws.ClientInfo) bool {
+			return info.ID == clientID
+		})
+		if registered {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fmt.Errorf("wstest: client %q was not registered (is the hub running?)", clientID)
+}
+
+// Client is an in-memory connection to the hub
+type Client struct {
+	ID string
+
+	conn *websocket.Conn
+
+	// Messages coalesced into one frame that haven't been returned yet
+	pending [][]byte
+}
+
+// Next returns the next message the client received, waiting up to timeout
+// Batches are returned as a single "batch" message
+func (c *Client) Next(timeout time.Duration) (Message, error) {
+	if len(c.pending) == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return Message{}, err
+		}
+		if messageType == websocket.BinaryMessage {
+			return Message{Raw: data}, nil
+		}
+		// The hub coalesces queued text messages into one frame, one per line
+		c.pending = bytes.Split(data, []byte{'\n'})
+	}
+
+	raw := c.pending[0]
+	c.pending = c.pending[1:]
+
+	msg := Message{Raw: raw}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return msg, fmt.Errorf("wstest: decode message: %w", err)
+	}
+	return msg, nil
+}
+
+// Send sends a message to the hub as the client
+func (c *Client) Send(eventType string, data interface{}) error {
+	return c.conn.WriteJSON(ws.Message{Type: eventType, Data: data})
+}
+
+// Conn returns the underlying connection for lower-level assertions
+func (c *Client) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// Close closes the connection without a close handshake
+func (c *Client) Close() error {
+	return c.conn.Close()
+}